@@ -0,0 +1,91 @@
+// Command gotank runs tools for the IndexTank API.
+//
+// Usage:
+//
+//	gotank serve [-addr 127.0.0.1:8080] [-data gotank-data]
+//
+// The serve command runs a local server implementing the IndexTank v1 REST API used by the
+// indextank package, with the indexes saved in the data directory, so that
+//
+//	client, err := indextank.NewApiClient("http://localhost:8080")
+//
+// works against it unmodified. The server has no authentication and lets clients change and delete
+// indexes, so by default it only accepts local connections; use -addr :8080 to listen on every
+// interface, e.g. so that other containers can reach it.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/searchify/gotank/indextank/server"
+)
+
+const usage = `Usage: gotank <command> [arguments]
+
+Commands:
+  serve   run a local IndexTank-compatible server
+
+Run "gotank <command> -h" for the arguments of a command.
+`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("gotank: ")
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	switch os.Args[1] {
+	case "serve":
+		serve(os.Args[2:])
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "gotank: unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+}
+
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "127.0.0.1:8080", "address to listen on, e.g. :8080 for every interface")
+	data := flags.String("data", "gotank-data", "directory the indexes are saved in")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		log.Fatalf("unexpected arguments: %v", flags.Args())
+	}
+
+	handler, err := server.Open(*data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv := &http.Server{Addr: *addr, Handler: handler}
+
+	// shut down cleanly on interrupt, e.g. when docker stops the container
+	done := make(chan struct{})
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Print(err)
+		}
+		close(done)
+	}()
+
+	log.Printf("serving the IndexTank API on %s, with indexes in %s", *addr, *data)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-done
+}
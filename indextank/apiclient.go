@@ -19,6 +19,7 @@
 package indextank
 
 import (
+	"context"
 	"errors"
 	"net/url"
 	"strings"
@@ -31,23 +32,41 @@ type ApiClient interface {
 	GetIndex(name string) Index
 	// Creates a new search index on the server
 	CreateIndex(name string) (Index, error)
+	// Like CreateIndex, using ctx for the request.
+	CreateIndexContext(ctx context.Context, name string) (Index, error)
 	// Creates a new search index on the server, with options. The only current option
 	// is a boolean "public_search", which sets whether public searches are allowed.
 	CreateIndexWithOptions(name string, options map[string]interface{}) (Index, error)
+	// Like CreateIndexWithOptions, using ctx for the request.
+	CreateIndexWithOptionsContext(ctx context.Context, name string, options map[string]interface{}) (Index, error)
 	// Updates options for a search index.
 	UpdateIndex(name string, options map[string]interface{}) error
+	// Like UpdateIndex, using ctx for the request.
+	UpdateIndexContext(ctx context.Context, name string, options map[string]interface{}) error
 	// Deletes a search index.
 	DeleteIndex(name string) error
+	// Like DeleteIndex, using ctx for the request.
+	DeleteIndexContext(ctx context.Context, name string) error
 	// Lists search indexes for this account.
 	ListIndexes() (map[string]Index, error)
+	// Like ListIndexes, using ctx for the request.
+	ListIndexesContext(ctx context.Context) (map[string]Index, error)
 }
 
 type indexTankClient struct {
 	apiUrl string
+	conn   *connection
 }
 
 // Returns a new ApiClient from a Searchify API URL.
 func NewApiClient(apiUrl string) (ApiClient, error) {
+	return NewApiClientWithOptions(apiUrl)
+}
+
+// Returns a new ApiClient from a Searchify API URL, configured by options such as
+// WithHTTPClient, WithTransport, WithTimeout, WithOperationTimeout, WithRetryPolicy and WithUserAgent.
+// Options are applied in order. The ApiClient and every Index it returns share the configuration.
+func NewApiClientWithOptions(apiUrl string, options ...ClientOption) (ApiClient, error) {
 	// validate URL
 	uri, err := url.Parse(apiUrl)
 	if err != nil {
@@ -59,53 +78,78 @@ func NewApiClient(apiUrl string) (ApiClient, error) {
 	if strings.HasSuffix(apiUrl, "/") {
 		apiUrl = apiUrl[0 : len(apiUrl)-1]
 	}
-	client := indexTankClient{apiUrl}
+	client := indexTankClient{apiUrl, newConnection(options...)}
 	return &client, nil
 }
 
 // Returns a search Index for this account.
 func (client *indexTankClient) GetIndex(name string) Index {
 	indexUrl := makeIndexUrl(client.apiUrl, name)
-	ic := IndexClient{url: indexUrl}
+	ic := IndexClient{url: indexUrl, conn: client.conn}
 	return &ic
 }
 
 // Creates a new search index.
 func (client *indexTankClient) CreateIndex(name string) (Index, error) { // todo: add options param
+	return client.CreateIndexContext(context.Background(), name)
+}
+
+// Like CreateIndex, using ctx for the request.
+func (client *indexTankClient) CreateIndexContext(ctx context.Context, name string) (Index, error) {
 	indexUrl := makeIndexUrl(client.apiUrl, name)
-	index := IndexClient{url: indexUrl}
-	return &index, index.CreateIndex()
+	index := IndexClient{url: indexUrl, conn: client.conn}
+	return &index, index.CreateIndexContext(ctx)
 }
 
 // Creates a new search index, with optional parameters.
 // Allowed parameters are currently:
 // "public_search", a boolean - whether to enable searches to this index using the public API URL
 func (client *indexTankClient) CreateIndexWithOptions(name string, options map[string]interface{}) (Index, error) {
+	return client.CreateIndexWithOptionsContext(context.Background(), name, options)
+}
+
+// Like CreateIndexWithOptions, using ctx for the request.
+func (client *indexTankClient) CreateIndexWithOptionsContext(ctx context.Context, name string, options map[string]interface{}) (Index, error) {
 	indexUrl := makeIndexUrl(client.apiUrl, name)
-	index := IndexClient{url: indexUrl}
-	return &index, index.CreateIndexWithOptions(options)
+	index := IndexClient{url: indexUrl, conn: client.conn}
+	return &index, index.CreateIndexWithOptionsContext(ctx, options)
 }
 
 // Updates the options for this index.  Currently allowed index options:
 // "public_search" - see the CreateIndexWithOptions doc above.
 func (client *indexTankClient) UpdateIndex(name string, options map[string]interface{}) error {
+	return client.UpdateIndexContext(context.Background(), name, options)
+}
+
+// Like UpdateIndex, using ctx for the request.
+func (client *indexTankClient) UpdateIndexContext(ctx context.Context, name string, options map[string]interface{}) error {
 	indexUrl := makeIndexUrl(client.apiUrl, name)
-	index := IndexClient{url: indexUrl}
-	return index.UpdateIndex(options)
+	index := IndexClient{url: indexUrl, conn: client.conn}
+	return index.UpdateIndexContext(ctx, options)
 }
 
 // Permanently deletes the specified index and all its documents from the server.
 func (client *indexTankClient) DeleteIndex(name string) error {
+	return client.DeleteIndexContext(context.Background(), name)
+}
+
+// Like DeleteIndex, using ctx for the request.
+func (client *indexTankClient) DeleteIndexContext(ctx context.Context, name string) error {
 	indexUrl := makeIndexUrl(client.apiUrl, name)
-	index := IndexClient{url: indexUrl}
-	return index.DeleteIndex()
+	index := IndexClient{url: indexUrl, conn: client.conn}
+	return index.DeleteIndexContext(ctx)
 }
 
 // Lists all indexes for this account, returning a map from index name to Index.
 func (client *indexTankClient) ListIndexes() (map[string]Index, error) {
+	return client.ListIndexesContext(context.Background())
+}
+
+// Like ListIndexes, using ctx for the request.
+func (client *indexTankClient) ListIndexesContext(ctx context.Context) (map[string]Index, error) {
 	uri := makeIndexUrl(client.apiUrl, "")
 
-	m, err := doRequest("GET", uri, nil)
+	m, err := client.conn.doRequest(ctx, OperationAdmin, "GET", uri, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -114,7 +158,7 @@ func (client *indexTankClient) ListIndexes() (map[string]Index, error) {
 	//m := i.(map[string]interface{})
 	for k, v := range m {
 		indexUrl := uri + k //"/" + k
-		indexClient := IndexClient{url: indexUrl, metadata: v.(map[string]interface{})}
+		indexClient := IndexClient{url: indexUrl, metadata: v.(map[string]interface{}), conn: client.conn}
 		//indexes = append(indexes, indexClient)
 		indexMap[k] = &indexClient
 	}
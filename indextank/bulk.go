@@ -17,6 +17,10 @@ type BulkDeleteResults interface {
 	GetFailedDocids() []string
 }
 
+// Returns the results of a call to UpdateCategoriesBatch batch call; these have the same shape as
+// bulk delete results
+type BulkUpdateResults = BulkDeleteResults
+
 type addResults struct {
 	hasErrors bool
 	results   []bool
@@ -64,6 +68,15 @@ func newBulkResults(documentIds []string, r []deleteResult) BulkDeleteResults {
 	}
 }
 
+// Bulk update results
+func newUpdateResults(documentIds []string, r []updateResult) BulkUpdateResults {
+	d := make([]deleteResult, len(r))
+	for i, v := range r {
+		d[i] = deleteResult{Deleted: v.Updated, Error: v.Error}
+	}
+	return newBulkResults(documentIds, d)
+}
+
 func (r *deleteResults) HasErrors() bool {
 	return r.hasErrors
 }
@@ -0,0 +1,300 @@
+package indextank
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults used for zero BulkIndexerConfig fields.
+const (
+	defaultBulkWorkers       = 4
+	defaultBulkBatchSize     = 500
+	defaultBulkBatchBytes    = 1024 * 1024
+	defaultBulkFlushInterval = time.Second
+)
+
+// ErrBulkIndexerClosed is returned when adding to or deleting from a closed BulkIndexer.
+var ErrBulkIndexerClosed = errors.New("BulkIndexer is closed")
+
+// errBulkNoResults is reported for the documents of a batch the index returned neither a result nor an error for.
+var errBulkNoResults = errors.New("The index returned no batch result for the document")
+
+// BulkIndexerConfig configures a BulkIndexer.
+type BulkIndexerConfig struct {
+	// Number of concurrent requests to the index. Defaults to 4.
+	NumWorkers int
+	// Maximum number of documents, or document ids, per request. Defaults to 500.
+	MaxBatchSize int
+	// Maximum approximate JSON size of the documents in one request. Defaults to 1MB.
+	// A single document larger than this is sent on its own.
+	MaxBatchBytes int
+	// Pending documents are sent at least this often. Defaults to 1s; a negative value
+	// disables time based flushing.
+	FlushInterval time.Duration
+	// If set, called with the outcome of every added document: a nil error, the error
+	// message the server reported for this document, or the error of the whole request.
+	OnAdd func(doc Document, err error)
+	// If set, called with the outcome of every deleted document id, like OnAdd.
+	OnDelete func(docid string, err error)
+}
+
+// BulkIndexerStats holds counters of a BulkIndexer.
+type BulkIndexerStats struct {
+	// Documents added and deleted successfully
+	Added   int64
+	Deleted int64
+	// Documents whose add or delete failed
+	Failed int64
+	// Batch requests sent
+	Requests int64
+}
+
+// BulkIndexer groups documents to add and document ids to delete into batches, sent with
+// Index.AddDocumentsContext and Index.DeleteDocumentsContext by a pool of workers.
+// It is safe for use by multiple goroutines. Adds and deletes are sent in separate batches,
+// so adding and deleting the same document id in quick succession may be applied in either order.
+//
+// The OnAdd and OnDelete callbacks are called from the worker goroutines.
+type BulkIndexer interface {
+	// Add queues a document to be added, blocking while the queue is full.
+	Add(ctx context.Context, doc Document) error
+	// Delete queues a document id to be deleted, blocking while the queue is full.
+	Delete(ctx context.Context, docid string) error
+	// Close sends all pending documents, waits for the outstanding requests to finish and
+	// stops the workers.
+	Close() error
+	// Stats returns the counters of this BulkIndexer.
+	Stats() BulkIndexerStats
+}
+
+type bulkItem struct {
+	doc    Document
+	docid  string
+	delete bool
+	size   int
+}
+
+type bulkBatch struct {
+	docs   []Document
+	docids []string
+}
+
+type bulkIndexer struct {
+	index  Index
+	config BulkIndexerConfig
+
+	mu     sync.RWMutex // guards closed, and sending on items
+	closed bool
+	items  chan bulkItem
+	work   chan bulkBatch
+	wg     sync.WaitGroup
+
+	stats BulkIndexerStats
+}
+
+// NewBulkIndexer returns a BulkIndexer sending batches to index. Close it when done.
+func NewBulkIndexer(index Index, config BulkIndexerConfig) BulkIndexer {
+	if config.NumWorkers <= 0 {
+		config.NumWorkers = defaultBulkWorkers
+	}
+	if config.MaxBatchSize <= 0 {
+		config.MaxBatchSize = defaultBulkBatchSize
+	}
+	if config.MaxBatchBytes <= 0 {
+		config.MaxBatchBytes = defaultBulkBatchBytes
+	}
+	if config.FlushInterval == 0 {
+		config.FlushInterval = defaultBulkFlushInterval
+	}
+
+	b := &bulkIndexer{
+		index:  index,
+		config: config,
+		items:  make(chan bulkItem, config.MaxBatchSize),
+		work:   make(chan bulkBatch, config.NumWorkers),
+	}
+	b.wg.Add(config.NumWorkers)
+	for i := 0; i < config.NumWorkers; i++ {
+		go b.worker()
+	}
+	go b.collect()
+	return b
+}
+
+func (b *bulkIndexer) Add(ctx context.Context, doc Document) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return b.enqueue(ctx, bulkItem{doc: doc, size: len(data)})
+}
+
+func (b *bulkIndexer) Delete(ctx context.Context, docid string) error {
+	// {"docid":"..."},
+	return b.enqueue(ctx, bulkItem{docid: docid, delete: true, size: len(docid) + 12})
+}
+
+func (b *bulkIndexer) enqueue(ctx context.Context, item bulkItem) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return ErrBulkIndexerClosed
+	}
+	select {
+	case b.items <- item:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *bulkIndexer) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBulkIndexerClosed
+	}
+	b.closed = true
+	close(b.items)
+	b.mu.Unlock()
+
+	b.wg.Wait()
+	return nil
+}
+
+func (b *bulkIndexer) Stats() BulkIndexerStats {
+	return BulkIndexerStats{
+		Added:    atomic.LoadInt64(&b.stats.Added),
+		Deleted:  atomic.LoadInt64(&b.stats.Deleted),
+		Failed:   atomic.LoadInt64(&b.stats.Failed),
+		Requests: atomic.LoadInt64(&b.stats.Requests),
+	}
+}
+
+// collect groups queued items into batches and hands them to the workers.
+func (b *bulkIndexer) collect() {
+	var adds, deletes bulkBatch
+	var addBytes, deleteBytes int
+
+	flushAdds := func() {
+		if len(adds.docs) > 0 {
+			b.work <- adds
+			adds, addBytes = bulkBatch{}, 0
+		}
+	}
+	flushDeletes := func() {
+		if len(deletes.docids) > 0 {
+			b.work <- deletes
+			deletes, deleteBytes = bulkBatch{}, 0
+		}
+	}
+
+	var tick <-chan time.Time
+	if b.config.FlushInterval > 0 {
+		ticker := time.NewTicker(b.config.FlushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case item, ok := <-b.items:
+			if !ok {
+				flushAdds()
+				flushDeletes()
+				close(b.work)
+				return
+			}
+			if item.delete {
+				if deleteBytes+item.size > b.config.MaxBatchBytes {
+					flushDeletes()
+				}
+				deletes.docids = append(deletes.docids, item.docid)
+				deleteBytes += item.size
+				if len(deletes.docids) >= b.config.MaxBatchSize {
+					flushDeletes()
+				}
+			} else {
+				if addBytes+item.size > b.config.MaxBatchBytes {
+					flushAdds()
+				}
+				adds.docs = append(adds.docs, item.doc)
+				addBytes += item.size
+				if len(adds.docs) >= b.config.MaxBatchSize {
+					flushAdds()
+				}
+			}
+		case <-tick:
+			flushAdds()
+			flushDeletes()
+		}
+	}
+}
+
+func (b *bulkIndexer) worker() {
+	defer b.wg.Done()
+	ctx := context.Background()
+	for batch := range b.work {
+		atomic.AddInt64(&b.stats.Requests, 1)
+		if batch.docs != nil {
+			results, err := b.index.AddDocumentsContext(ctx, batch.docs)
+			if err == nil && results == nil {
+				err = errBulkNoResults
+			}
+			// on errors results is not used, and documents it has no result for get errBulkNoResults
+			for i, doc := range batch.docs {
+				docErr := err
+				if err == nil {
+					docErr = resultError(results.GetResult, results.GetErrorMessage, i)
+				}
+				b.report(docErr, &b.stats.Added)
+				if b.config.OnAdd != nil {
+					b.config.OnAdd(doc, docErr)
+				}
+			}
+		} else {
+			results, err := b.index.DeleteDocumentsContext(ctx, batch.docids)
+			if err == nil && results == nil {
+				err = errBulkNoResults
+			}
+			for i, docid := range batch.docids {
+				docErr := err
+				if err == nil {
+					docErr = resultError(results.GetResult, results.GetErrorMessage, i)
+				}
+				b.report(docErr, &b.stats.Deleted)
+				if b.config.OnDelete != nil {
+					b.config.OnDelete(docid, docErr)
+				}
+			}
+		}
+	}
+}
+
+// resultError returns the error for element i of batch results, or errBulkNoResults if there is no
+// such element: an Index other than IndexClient may return fewer results than it was sent, and
+// the results then panic when asked about the missing ones.
+func resultError(result func(int) bool, message func(int) (string, bool), i int) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = errBulkNoResults
+		}
+	}()
+	if result(i) {
+		return nil
+	}
+	msg, _ := message(i)
+	return errors.New(msg)
+}
+
+func (b *bulkIndexer) report(err error, succeeded *int64) {
+	if err != nil {
+		atomic.AddInt64(&b.stats.Failed, 1)
+	} else {
+		atomic.AddInt64(succeeded, 1)
+	}
+}
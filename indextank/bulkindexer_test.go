@@ -0,0 +1,80 @@
+package indextank
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDeleteDocumentsShortResults(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"deleted": true}]`))
+	}))
+	defer srv.Close()
+	client, err := NewApiClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := client.GetIndex("test")
+
+	if _, err := idx.DeleteDocuments([]string{"a", "b"}); err == nil {
+		t.Error("DeleteDocuments accepted 1 result for 2 docids")
+	}
+
+	var failed []string
+	bulk := NewBulkIndexer(idx, BulkIndexerConfig{
+		NumWorkers: 1,
+		OnDelete: func(docid string, err error) {
+			if err != nil {
+				failed = append(failed, docid)
+			}
+		},
+	})
+	bulk.Delete(context.Background(), "a")
+	bulk.Delete(context.Background(), "b")
+	bulk.Close()
+	if len(failed) != 2 {
+		t.Errorf("failed deletes = %v, want [a b]", failed)
+	}
+}
+
+// shortResultsIndex is an Index whose batch calls return results for the first document only.
+type shortResultsIndex struct {
+	*MemoryIndex
+}
+
+func (idx shortResultsIndex) AddDocumentsContext(ctx context.Context, documents []Document) (BatchResults, error) {
+	return newBatchResults(documents[:1], []addResult{{Added: true}}), nil
+}
+
+func (idx shortResultsIndex) DeleteDocumentsContext(ctx context.Context, documentIds []string) (BulkDeleteResults, error) {
+	return newBulkResults(documentIds[:1], []deleteResult{{Deleted: true}}), nil
+}
+
+func TestBulkIndexerShortResults(t *testing.T) {
+	var added, deleted []error
+	bulk := NewBulkIndexer(shortResultsIndex{NewMemoryIndex()}, BulkIndexerConfig{
+		NumWorkers:    1,
+		FlushInterval: -1,
+		OnAdd:         func(doc Document, err error) { added = append(added, err) },
+		OnDelete:      func(docid string, err error) { deleted = append(deleted, err) },
+	})
+	ctx := context.Background()
+	for _, docid := range []string{"a", "b", "c"} {
+		bulk.Add(ctx, Document{Id: docid, Fields: map[string]string{"text": "hello"}})
+	}
+	for _, docid := range []string{"a", "b", "c"} {
+		bulk.Delete(ctx, docid)
+	}
+	bulk.Close()
+
+	want := []error{nil, errBulkNoResults, errBulkNoResults}
+	if !reflect.DeepEqual(added, want) || !reflect.DeepEqual(deleted, want) {
+		t.Errorf("add errors %v, delete errors %v, want %v", added, deleted, want)
+	}
+	if stats := bulk.Stats(); stats.Added != 1 || stats.Deleted != 1 || stats.Failed != 4 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
@@ -0,0 +1,14 @@
+package indextank_test
+
+import (
+	"testing"
+
+	"github.com/searchify/gotank/indextank"
+	"github.com/searchify/gotank/indextank/indextanktest"
+)
+
+func TestMemoryIndexConformance(t *testing.T) {
+	indextanktest.RunIndexConformance(t, func(t *testing.T) indextank.Index {
+		return indextank.NewMemoryIndex()
+	})
+}
@@ -0,0 +1,278 @@
+package indextank
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// DecodeError describes a value of a search result that can't be stored in a struct field.
+type DecodeError struct {
+	// Docid of the search result
+	Docid string
+	// Part of the result, e.g. "variable 0" or "field title"
+	Source string
+	// Struct field, e.g. "Product.Price"
+	Field string
+	Err   error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("Can't decode %s of document %q into %s: %v", e.Source, e.Docid, e.Field, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Decode stores the hit in the struct pointed to by v, using the indextank tags of its fields as
+// described for MarshalDocument, and these tags for parts of search results that are not in documents:
+//
+//	Score   float64 `indextank:"score"`         // the value of the scoring function
+//	Snippet string  `indextank:"snippet=text"`  // the snippet of the text field
+//
+// Struct fields whose part is missing from the hit, e.g. fields that weren't fetched, are left
+// unchanged. Text is converted to the type of the struct field, e.g. with strconv.ParseInt for
+// ints, and parsed as RFC 3339 or seconds since the epoch for times. Values that can't be converted,
+// like "abc" for an int or 1.5 for an int variable, are reported with a *DecodeError.
+func (h Hit) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Can't decode a hit into %T, it is not a pointer to a struct", v)
+	}
+	return h.decode(rv.Elem())
+}
+
+func (h Hit) decode(rv reflect.Value) error {
+	m, err := mappingOf(rv.Type())
+	if err != nil {
+		return err
+	}
+	for _, fm := range m.fields {
+		var err error
+		switch fm.kind {
+		case tagDocid:
+			err = setText(allocField(rv, fm.index), h.Docid, false)
+		case tagScore:
+			err = setNumber(allocField(rv, fm.index), h.Score)
+		case tagVar:
+			if f, ok := h.Variables[fm.num]; ok {
+				err = setNumber(allocField(rv, fm.index), f)
+			}
+		case tagTimestamp:
+			if s, ok := h.Fields[timestampField]; ok {
+				err = setTimestamp(allocField(rv, fm.index), s)
+			}
+		case tagField:
+			if s, ok := h.Fields[fm.name]; ok {
+				err = setText(allocField(rv, fm.index), s, true)
+			}
+		case tagCategory:
+			if s, ok := h.Categories[fm.name]; ok {
+				err = setText(allocField(rv, fm.index), s, false)
+			}
+		case tagSnippet:
+			if s, ok := h.Snippets[fm.name]; ok {
+				err = setText(allocField(rv, fm.index), s, false)
+			}
+		}
+		if err != nil {
+			return &DecodeError{Docid: h.Docid, Source: fm.target(), Field: fm.goName, Err: err}
+		}
+	}
+	return nil
+}
+
+// allocField returns the struct field of v at index, allocating nil embedded pointers on the way.
+func allocField(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// alloc returns the value pointed to by v, allocating nil pointers.
+func alloc(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// setText stores text in v, splitting it into words for slices if list is set.
+func setText(v reflect.Value, s string, list bool) error {
+	v = alloc(v)
+	t := v.Type()
+	switch {
+	case t == timeType:
+		tm, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			f, ferr := strconv.ParseFloat(s, 64)
+			if ferr != nil {
+				return err
+			}
+			tm = unixTime(f)
+		}
+		v.Set(reflect.ValueOf(tm))
+		return nil
+	case reflect.PtrTo(t).Implements(textUnmarshalerType):
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if t == durationType {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 10, t.Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(s, 10, t.Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, t.Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(s))
+			return nil
+		}
+		if !list {
+			break
+		}
+		words := strings.Fields(s)
+		slice := reflect.MakeSlice(t, len(words), len(words))
+		for i, w := range words {
+			if err := setText(slice.Index(i), w, false); err != nil {
+				return fmt.Errorf("word %d: %v", i, err)
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+	return fmt.Errorf("text can't be stored in a %s", t)
+}
+
+// setNumber stores a variable or score in v.
+func setNumber(v reflect.Value, f float64) error {
+	v = alloc(v)
+	t := v.Type()
+	switch {
+	case t == timeType:
+		v.Set(reflect.ValueOf(unixTime(f)))
+		return nil
+	case t == durationType:
+		v.SetInt(int64(f * float64(time.Second)))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(f != 0)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 || v.OverflowInt(int64(f)) {
+			return fmt.Errorf("%v doesn't fit in a %s", f, t)
+		}
+		v.SetInt(int64(f))
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 || v.OverflowUint(uint64(f)) {
+			return fmt.Errorf("%v doesn't fit in a %s", f, t)
+		}
+		v.SetUint(uint64(f))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(f)
+		return nil
+	case reflect.String:
+		v.SetString(strconv.FormatFloat(f, 'g', -1, 64))
+		return nil
+	}
+	return fmt.Errorf("a number can't be stored in a %s", t)
+}
+
+// setTimestamp stores a timestamp field, in seconds since the epoch, in v.
+func setTimestamp(v reflect.Value, s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	return setNumber(v, f)
+}
+
+func unixTime(seconds float64) time.Time {
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// decodeHits stores hits in the slice pointed to by v, see SearchResults.Decode.
+func decodeHits(hits []Hit, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("Can't decode hits into %T, it is not a pointer to a slice", v)
+	}
+	slice := rv.Elem()
+	elem := slice.Type().Elem()
+	structType := elem
+	if elem.Kind() == reflect.Ptr {
+		structType = elem.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return fmt.Errorf("Can't decode hits into %T, its elements are not structs", v)
+	}
+
+	decoded := reflect.MakeSlice(slice.Type(), len(hits), len(hits))
+	for i, hit := range hits {
+		e := alloc(decoded.Index(i))
+		if err := hit.decode(e); err != nil {
+			return err
+		}
+	}
+	slice.Set(decoded)
+	return nil
+}
+
+func (r *searchResults) Decode(v interface{}) error {
+	return decodeHits(r.GetHits(), v)
+}
@@ -0,0 +1,89 @@
+package indextank
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type roundTrip struct {
+	ID       string          `indextank:"docid"`
+	Text     string          `indextank:"field=text"`
+	Count    int             `indextank:"field=count"`
+	Tags     []string        `indextank:"field=tags"`
+	Timeout  time.Duration   `indextank:"field=timeout"`
+	Steps    []time.Duration `indextank:"field=steps"`
+	Created  time.Time       `indextank:"field=created"`
+	Color    string          `indextank:"category=color"`
+	Wait     time.Duration   `indextank:"category=wait"`
+	Price    float64         `indextank:"var=0"`
+	Interval time.Duration   `indextank:"var=1"`
+	Active   bool            `indextank:"var=2"`
+}
+
+// hitOf returns the hit a search fetching everything would return for doc.
+func hitOf(doc Document) Hit {
+	vars := map[int]float64{}
+	for n, v := range doc.NumberedVariables() {
+		vars[n] = float64(v)
+	}
+	return Hit{Docid: doc.Id, Fields: doc.Fields, Variables: vars, Categories: doc.Categories}
+}
+
+func TestMarshalDecodeRoundTrip(t *testing.T) {
+	want := roundTrip{
+		ID:       "doc1",
+		Text:     "hello world",
+		Count:    42,
+		Tags:     []string{"a", "b"},
+		Timeout:  1500 * time.Millisecond,
+		Steps:    []time.Duration{time.Second, 2 * time.Minute},
+		Created:  time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC),
+		Color:    "red",
+		Wait:     90 * time.Second,
+		Price:    9.5,
+		Interval: 30 * time.Second,
+		Active:   true,
+	}
+	doc, err := MarshalDocument(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Fields["timeout"] != "1.5s" {
+		t.Errorf("timeout field = %q, want 1.5s", doc.Fields["timeout"])
+	}
+
+	var got roundTrip
+	if err := hitOf(doc).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Created.Equal(want.Created) {
+		t.Errorf("Created = %v, want %v", got.Created, want.Created)
+	}
+	got.Created = want.Created
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		hit    Hit
+		source string
+	}{
+		{Hit{Docid: "d", Fields: map[string]string{"count": "abc"}}, "field count"},
+		{Hit{Docid: "d", Fields: map[string]string{"timeout": "soon"}}, "field timeout"},
+		{Hit{Docid: "d", Fields: map[string]string{"timeout": "1500000000"}}, "field timeout"},
+		{Hit{Docid: "d", Variables: map[int]float64{0: 1}, Fields: map[string]string{"tags": "x", "created": "yesterday"}}, "field created"},
+		{Hit{Docid: "d", Categories: map[string]string{"wait": "x"}}, "category wait"},
+	}
+	for _, test := range tests {
+		var v roundTrip
+		err := test.hit.Decode(&v)
+		var de *DecodeError
+		if !errors.As(err, &de) || de.Source != test.source {
+			t.Errorf("Decode(%+v) = %v, want a DecodeError for %s", test.hit, err, test.source)
+		}
+	}
+}
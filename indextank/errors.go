@@ -0,0 +1,94 @@
+package indextank
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// Errors returned, wrapped in an *APIError, by ApiClient and Index methods. Test for them with errors.Is:
+//
+//	if errors.Is(err, indextank.ErrIndexNotFound) { ... }
+var (
+	// ErrIndexNotFound means the index does not exist.
+	ErrIndexNotFound = errors.New("Index does not exist")
+	// ErrIndexAlreadyExists is returned when creating an index that already exists.
+	ErrIndexAlreadyExists = errors.New("Index already exists")
+	// ErrTooManyIndexes is returned when creating an index would exceed the account's index limit.
+	ErrTooManyIndexes = errors.New("Maximum indexes limit reached for this account")
+	// ErrInvalidQuery means the server rejected a search query.
+	ErrInvalidQuery = errors.New("Invalid query")
+	// ErrIndexNotStarted means the index exists but is still initializing and can't serve requests yet.
+	ErrIndexNotStarted = errors.New("Index has not started yet")
+)
+
+// maximum number of response body bytes kept in an APIError
+const maxErrorBodySize = 64 * 1024
+
+// APIError describes an unsuccessful response from the server. Use errors.As to inspect it.
+type APIError struct {
+	// HTTP status code of the response
+	StatusCode int
+	// HTTP method of the request
+	Method string
+	// URL of the request, with the API key (the password of the API URL) redacted
+	URL string
+	// Response body sent by the server, usually a plain text error message
+	Body string
+	// One of the Err... sentinel errors above, or nil if the status has no specific meaning
+	Err error
+}
+
+func (e *APIError) Error() string {
+	s := fmt.Sprintf("HTTP %d from %s %s", e.StatusCode, e.Method, e.URL)
+	if e.Err != nil {
+		s = e.Err.Error() + " (" + s + ")"
+	} else {
+		s = "Unexpected " + s
+	}
+	if e.Body != "" {
+		s += ": " + e.Body
+	}
+	return s
+}
+
+// Unwrap returns the sentinel error matching the response status, if any.
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// newAPIError builds an *APIError from an unsuccessful response, reading (but not closing) its body.
+func newAPIError(resp *http.Response, err error) *APIError {
+	apiErr := &APIError{StatusCode: resp.StatusCode, Err: err}
+	if resp.Request != nil {
+		apiErr.Method = resp.Request.Method
+		if resp.Request.URL != nil {
+			apiErr.URL = resp.Request.URL.Redacted()
+		}
+	}
+	if resp.Body != nil {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		apiErr.Body = string(body)
+	}
+	return apiErr
+}
+
+// statusError maps an unsuccessful response of an operation to an *APIError wrapping the matching
+// sentinel error. Index creation has its own meaning for some statuses, see CreateIndexWithOptions.
+func statusError(op Operation, resp *http.Response) error {
+	var err error
+	switch resp.StatusCode {
+	case 404:
+		err = ErrIndexNotFound
+	case 409:
+		// all calls but index creation answer 409 while the index is initializing
+		err = ErrIndexNotStarted
+	case 400:
+		if op == OperationSearch {
+			err = ErrInvalidQuery
+		}
+	}
+	return newAPIError(resp, err)
+}
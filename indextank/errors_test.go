@@ -0,0 +1,109 @@
+package indextank
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		op     Operation
+		status int
+		want   error
+	}{
+		{OperationAdmin, 404, ErrIndexNotFound},
+		{OperationIndexing, 404, ErrIndexNotFound},
+		{OperationSearch, 404, ErrIndexNotFound},
+		{OperationIndexing, 409, ErrIndexNotStarted},
+		{OperationSearch, 409, ErrIndexNotStarted},
+		{OperationSearch, 400, ErrInvalidQuery},
+		{OperationIndexing, 400, nil},
+		{OperationAdmin, 500, nil},
+		{OperationSearch, 503, nil},
+	}
+	for _, test := range tests {
+		resp := &http.Response{
+			StatusCode: test.status,
+			Body:       ioutil.NopCloser(strings.NewReader("details")),
+			Request:    &http.Request{Method: "GET", URL: &url.URL{Scheme: "http", Host: "example.com", Path: "/v1/indexes/test"}},
+		}
+		err := statusError(test.op, resp)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("statusError(%v, %d) = %v, want an *APIError", test.op, test.status, err)
+		}
+		if apiErr.StatusCode != test.status || apiErr.Body != "details" || apiErr.Err != test.want {
+			t.Errorf("statusError(%v, %d) = %+v, want Err %v", test.op, test.status, apiErr, test.want)
+		}
+		for _, sentinel := range []error{ErrIndexNotFound, ErrIndexNotStarted, ErrInvalidQuery} {
+			if is := errors.Is(err, sentinel); is != (sentinel == test.want) {
+				t.Errorf("errors.Is(statusError(%v, %d), %v) = %v", test.op, test.status, sentinel, is)
+			}
+		}
+	}
+}
+
+func TestAPIErrorMessage(t *testing.T) {
+	tests := []struct {
+		err  APIError
+		want string
+	}{
+		{APIError{StatusCode: 404, Method: "GET", URL: "http://x/v1/indexes/a", Err: ErrIndexNotFound},
+			"Index does not exist (HTTP 404 from GET http://x/v1/indexes/a)"},
+		{APIError{StatusCode: 500, Method: "PUT", URL: "http://x/v1/indexes/a/docs", Body: "oops"},
+			"Unexpected HTTP 500 from PUT http://x/v1/indexes/a/docs: oops"},
+	}
+	for _, test := range tests {
+		if got := test.err.Error(); got != test.want {
+			t.Errorf("Error() = %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestAPIErrorRedactsPassword(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "No index existed for the given name", http.StatusNotFound)
+	}))
+	defer srv.Close()
+	apiUrl := strings.Replace(srv.URL, "http://", "http://:secretkey@", 1)
+	client, err := NewApiClient(apiUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.GetIndex("test").GetMetadata()
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !errors.Is(err, ErrIndexNotFound) {
+		t.Fatalf("GetMetadata = %v, want an *APIError for ErrIndexNotFound", err)
+	}
+	if strings.Contains(err.Error(), "secretkey") || strings.Contains(apiErr.URL, "secretkey") {
+		t.Errorf("error shows the API key: %v", err)
+	}
+	if !strings.Contains(apiErr.URL, "/v1/indexes/test") || apiErr.Method != "GET" {
+		t.Errorf("error has URL %q and method %q", apiErr.URL, apiErr.Method)
+	}
+}
+
+func TestUpdateIndexMetadataError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	client, err := NewApiClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.GetIndex("test").UpdateIndex(map[string]interface{}{"public_search": true})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.Method != "GET" {
+		t.Errorf("UpdateIndex = %v, want the error reading the metadata", err)
+	}
+}
@@ -0,0 +1,92 @@
+package indextank
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Keys of a search result that have a special meaning; every other string value is a fetched field.
+const (
+	docidKey       = "docid"
+	scoreKey       = "query_relevance_score"
+	variablePrefix = "variable_"
+	categoryPrefix = "category_"
+	snippetPrefix  = "snippet_"
+)
+
+// Hit is a single search result, see SearchResults.GetHits.
+type Hit struct {
+	// Docid is the id of the matching document.
+	Docid string
+	// Score is the value of the query's scoring function for the document.
+	Score float64
+	// Fields holds the fields requested with Query.FetchFields.
+	Fields map[string]string
+	// Variables holds the document variables, if requested with Query.FetchVariables.
+	Variables map[int]float64
+	// Categories holds the document categories, if requested with Query.FetchCategories.
+	Categories map[string]string
+	// Snippets holds the snippets of the fields requested with Query.SnippetFields, keyed by field name.
+	Snippets map[string]string
+	// Raw is the result as returned by the server, including any keys not covered above.
+	Raw map[string]interface{}
+}
+
+// newHit converts a raw search result, e.g.
+// {"docid": "1", "query_relevance_score": 2.5, "title": "a", "variable_0": 1.5, "category_color": "red", "snippet_text": "..."}
+func newHit(raw map[string]interface{}) Hit {
+	hit := Hit{
+		Fields:     map[string]string{},
+		Variables:  map[int]float64{},
+		Categories: map[string]string{},
+		Snippets:   map[string]string{},
+		Raw:        raw,
+	}
+	for k, v := range raw {
+		switch {
+		case k == docidKey:
+			hit.Docid = toString(v)
+		case k == scoreKey:
+			hit.Score, _ = toFloat(v)
+		case strings.HasPrefix(k, variablePrefix):
+			n, err := strconv.Atoi(k[len(variablePrefix):])
+			f, ok := toFloat(v)
+			if err == nil && ok {
+				hit.Variables[n] = f
+			}
+		case strings.HasPrefix(k, categoryPrefix):
+			hit.Categories[k[len(categoryPrefix):]] = toString(v)
+		case strings.HasPrefix(k, snippetPrefix):
+			hit.Snippets[k[len(snippetPrefix):]] = toString(v)
+		default:
+			if s, ok := v.(string); ok {
+				hit.Fields[k] = s
+			}
+		}
+	}
+	return hit
+}
+
+func toString(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case nil:
+		return ""
+	}
+	return ""
+}
+
+// toFloat converts a JSON number, or a string holding one, to a float64.
+func toFloat(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case string:
+		f, err := strconv.ParseFloat(x, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,68 @@
+package indextank
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestNewHit(t *testing.T) {
+	var raw map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"docid": "doc1",
+		"query_relevance_score": 2.5,
+		"title": "hello",
+		"variable_0": 1.5,
+		"variable_1": "-3",
+		"variable_x": 1,
+		"variable_2": "not a number",
+		"category_color": "red",
+		"snippet_text": "<b>hello</b> world",
+		"extra": 7
+	}`), &raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Hit{
+		Docid:      "doc1",
+		Score:      2.5,
+		Fields:     map[string]string{"title": "hello"},
+		Variables:  map[int]float64{0: 1.5, 1: -3},
+		Categories: map[string]string{"color": "red"},
+		Snippets:   map[string]string{"text": "<b>hello</b> world"},
+		Raw:        raw,
+	}
+	if got := newHit(raw); !reflect.DeepEqual(got, want) {
+		t.Errorf("newHit:\n got %+v\nwant %+v", got, want)
+	}
+
+	// a numeric docid and a score sent as a string
+	got := newHit(map[string]interface{}{"docid": 42.0, "query_relevance_score": "0.75"})
+	if got.Docid != "42" || got.Score != 0.75 {
+		t.Errorf("newHit = %+v, want docid 42 and score 0.75", got)
+	}
+}
+
+func TestSearchHits(t *testing.T) {
+	idx, _ := newRecordingServer(t, `{"matches": 2, "search_time": "0.002", "query": "hello", "results": [
+		{"docid": "a", "query_relevance_score": 2, "text": "hello"},
+		{"docid": "b", "query_relevance_score": 1, "category_color": "blue"}
+	]}`)
+	results, err := idx.Search("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits := results.GetHits()
+	if len(hits) != 2 || len(results.GetResults()) != 2 {
+		t.Fatalf("%d hits and %d results, want 2", len(hits), len(results.GetResults()))
+	}
+	if hits[0].Docid != "a" || hits[0].Score != 2 || hits[0].Fields["text"] != "hello" {
+		t.Errorf("hit 0 = %+v", hits[0])
+	}
+	if hits[1].Docid != "b" || hits[1].Score != 1 || hits[1].Categories["color"] != "blue" {
+		t.Errorf("hit 1 = %+v", hits[1])
+	}
+	if !reflect.DeepEqual(hits[0].Raw, results.GetResults()[0]) {
+		t.Errorf("hit 0 Raw = %v, want the raw result %v", hits[0].Raw, results.GetResults()[0])
+	}
+}
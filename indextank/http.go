@@ -2,15 +2,16 @@ package indextank
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"strconv"
+	"sort"
 	"strings"
+	"time"
 )
 
 const version = "0.3"
@@ -20,41 +21,148 @@ func makeIndexUrl(apiUrl, name string) string {
 	return fmt.Sprintf("%s/v1/indexes/%s", apiUrl, name)
 }
 
-func request(method, uri string, data interface{}) (*http.Response, error) {
+// connection holds the HTTP settings shared by an ApiClient and the Index clients it creates.
+// A nil *connection sends requests through http.DefaultClient without timeouts.
+type connection struct {
+	httpClient *http.Client
+	userAgent  string
+	timeout    time.Duration
+	timeouts   map[Operation]time.Duration
+	retry      *RetryPolicy
+	limits     *DocumentLimits
+}
+
+func newConnection(options ...ClientOption) *connection {
+	conn := &connection{}
+	for _, option := range options {
+		option(conn)
+	}
+	return conn
+}
+
+func (c *connection) client() *http.Client {
+	if c == nil || c.httpClient == nil {
+		return http.DefaultClient
+	}
+	return c.httpClient
+}
+
+func (c *connection) agent() string {
+	if c == nil || c.userAgent == "" {
+		return userAgent
+	}
+	return c.userAgent
+}
+
+func (c *connection) documentLimits() DocumentLimits {
+	if c == nil || c.limits == nil {
+		return DefaultDocumentLimits
+	}
+	return *c.limits
+}
+
+func (c *connection) retryPolicy() *RetryPolicy {
+	if c == nil {
+		return nil
+	}
+	return c.retry
+}
+
+func (c *connection) timeoutFor(op Operation) time.Duration {
+	if c == nil {
+		return 0
+	}
+	if d, ok := c.timeouts[op]; ok {
+		return d
+	}
+	return c.timeout
+}
+
+// cancelBody releases the timeout context of a request once the caller closes the response body.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// request sends an HTTP request, retrying it according to the connection's RetryPolicy; it is
+// aborted when ctx is cancelled, its deadline passes or the timeout configured for op expires.
+func (c *connection) request(ctx context.Context, op Operation, method, uri string, data interface{}) (*http.Response, error) {
 	method = strings.ToUpper(method)
 
-	var bodyReader io.Reader = nil
-	var contentLength int64 = 0
+	var body []byte = nil
 	if data != nil {
 		b, err := json.Marshal(data)
-		contentLength = int64(len(b))
 		if err != nil {
 			//fmt.Println("Error marshalling: %v\n", err)
 			return nil, err
 		}
 		//fmt.Println("  Marshalled request: ", string(b))
-		bodyReader = bytes.NewReader(b)
+		body = b
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if d := c.timeoutFor(op); d > 0 {
+		ctx, cancel = context.WithTimeout(ctx, d)
 	}
 
-	req, err := http.NewRequest(method, uri, bodyReader)
+	for attempt := 1; ; attempt++ {
+		req, err := c.newRequest(ctx, method, uri, body)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		resp, err := c.client().Do(req)
+
+		delay, retry := c.retryPolicy().next(ctx, attempt, req, resp, err)
+		if !retry {
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			resp.Body = &cancelBody{resp.Body, cancel}
+			// make sure the caller calls resp.Body.Close() if necessary
+			return resp, nil
+		}
+		if resp != nil {
+			// drain the body so the underlying connection can be reused
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := sleep(ctx, delay); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+}
+
+func (c *connection) newRequest(ctx context.Context, method, uri string, body []byte) (*http.Request, error) {
+	var bodyReader io.Reader = nil
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, uri, bodyReader)
 	if err != nil {
 		return nil, err
 	}
 
+	contentLength := int64(len(body))
 	if method == "POST" || method == "PUT" || (method == "DELETE" && contentLength > 0) {
 		//fmt.Printf("Setting content-length to %d for %s %s\n", contentLength, method, uri)
 		req.Header.Set("Content-Type", "application/json")
 		req.ContentLength = contentLength
 	}
 
-	req.Header.Set("User-Agent", userAgent)
-	httpClient := http.DefaultClient
-	resp, err := httpClient.Do(req)
-	// make sure the caller calls resp.Body.Close() if necessary
-	return resp, err
+	req.Header.Set("User-Agent", c.agent())
+	return req, nil
 }
 
-func doRequest(method, requestUrl string, params map[string]string) (map[string]interface{}, error) {
+func (c *connection) doRequest(ctx context.Context, op Operation, method, requestUrl string, params map[string]string) (map[string]interface{}, error) {
 	// caller must construct url
 	uri := requestUrl
 
@@ -62,18 +170,14 @@ func doRequest(method, requestUrl string, params map[string]string) (map[string]
 	uri += "?" + queryString
 	//fmt.Printf("---------> %s\n", queryString)
 
-	resp, err := request(method, uri, nil)
-
+	resp, err := c.request(ctx, op, method, uri, nil)
+	if err != nil {
+		return nil, err
+	}
 	defer resp.Body.Close()
 	//fmt.Printf(" [status %d]\n", resp.StatusCode)
-	if resp.StatusCode == 404 {
-		return nil, errors.New("Index does not exist")
-	}
-	if resp.StatusCode == 204 {
-		return nil, errors.New("Index Already Exists " + strconv.Itoa(resp.StatusCode))
-	}
-	if resp.StatusCode >= 400 {
-		return nil, errors.New("HTTP response " + strconv.Itoa(resp.StatusCode))
+	if !isOk(resp.StatusCode) {
+		return nil, statusError(op, resp)
 	}
 	body, err := ioutil.ReadAll(resp.Body)
 	//fmt.Printf("* ReadAll err: %v, body length = %d\n", err, len(body))
@@ -82,23 +186,23 @@ func doRequest(method, requestUrl string, params map[string]string) (map[string]
 		return nil, err
 	}
 
-	var i interface{}
-	err = json.Unmarshal(body, &i)
-
-	m := i.(map[string]interface{})
+	var m map[string]interface{}
+	err = json.Unmarshal(body, &m)
 	return m, err
 }
 
+// toQueryString encodes params sorted by name, so the same params always give the same string.
 func toQueryString(params map[string]string) string {
-	s := ""
-	if params == nil {
-		return s
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
 	}
-	for k, v := range params {
-		s += k + "=" + url.QueryEscape(v) + "&"
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + url.QueryEscape(params[k])
 	}
-	s = s[0 : len(s)-1]
-	return s
+	return strings.Join(pairs, "&")
 }
 
 func readResponseBody(resp *http.Response) (string, error) {
@@ -0,0 +1,52 @@
+package indextank
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newBlockingServer returns a server whose handler waits until the client gives up on the request.
+func newBlockingServer(calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+}
+
+func TestContextCancel(t *testing.T) {
+	var calls int32
+	srv := newBlockingServer(&calls)
+	defer srv.Close()
+	client, err := NewApiClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = client.GetIndex("test").SearchContext(ctx, "hello")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("SearchContext = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("SearchContext returned after %v", elapsed)
+	}
+
+	// a context that is already done doesn't send the request at all
+	before := atomic.LoadInt32(&calls)
+	if _, err := client.ListIndexesContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("ListIndexesContext = %v, want context.Canceled", err)
+	}
+	if after := atomic.LoadInt32(&calls); after != before {
+		t.Errorf("%d requests sent with a cancelled context", after-before)
+	}
+}
@@ -1,6 +1,7 @@
 package indextank
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,8 +15,12 @@ import (
 type Index interface {
 	// Exists returns whether this search index exists on the server.
 	Exists() bool
+	// ExistsContext is like Exists, using ctx for the request.
+	ExistsContext(ctx context.Context) bool
 	// HasStarted returns whether this search index is ready to receive requests
 	HasStarted() bool
+	// HasStartedContext is like HasStarted, using ctx for the request.
+	HasStartedContext(ctx context.Context) bool
 	// Status returns the running status of this search index
 	Status() string
 	// GetCode returns an internal identifier for this search index
@@ -28,50 +33,102 @@ type Index interface {
 	IsPublicSearchEnabled() bool
 	// CreateIndex creates a new search index on the server
 	CreateIndex() error
+	// CreateIndexContext is like CreateIndex, using ctx for the request.
+	CreateIndexContext(ctx context.Context) error
 	// CreateIndexWithOptions creates a new search index on the server with index options
 	CreateIndexWithOptions(options map[string]interface{}) error
-	// UpdateIndex updates the options for this search index
+	// CreateIndexWithOptionsContext is like CreateIndexWithOptions, using ctx for the request.
+	CreateIndexWithOptionsContext(ctx context.Context, options map[string]interface{}) error
+	// UpdateIndex updates the options for this search index, then reloads its metadata. If only
+	// reloading fails, the error says that the update was applied.
 	UpdateIndex(options map[string]interface{}) error
+	// UpdateIndexContext is like UpdateIndex, using ctx for the request.
+	UpdateIndexContext(ctx context.Context, options map[string]interface{}) error
 	// DeleteIndex deletes this search index
 	DeleteIndex() error
+	// DeleteIndexContext is like DeleteIndex, using ctx for the request.
+	DeleteIndexContext(ctx context.Context) error
 	// AddDocument adds a document to the search index. The variables and categories parameters can be nil.
 	AddDocument(docid string, fields map[string]string, variables map[int]float32, categories map[string]string) error
+	// AddDocumentContext is like AddDocument, using ctx for the request.
+	AddDocumentContext(ctx context.Context, docid string, fields map[string]string, variables map[int]float32, categories map[string]string) error
 	//AddDocumentWithCategories(docid string, fields map[string]string, variables map[int]float32, categories map[string]string) error
 	// AddDocuments adds a batch of document to the search index.
 	AddDocuments(documents []Document) (BatchResults, error)
+	// AddDocumentsContext is like AddDocuments, using ctx for the request.
+	AddDocumentsContext(ctx context.Context, documents []Document) (BatchResults, error)
 	// UpdateVariables updates document variables for a given document, without affecting its text fields.
 	UpdateVariables(documentId string, variables map[int]float32) error
+	// UpdateVariablesContext is like UpdateVariables, using ctx for the request.
+	UpdateVariablesContext(ctx context.Context, documentId string, variables map[int]float32) error
 	// UpdateCategories updates the categories for a given document.
 	UpdateCategories(documentId string, categories map[string]string) error
+	// UpdateCategoriesContext is like UpdateCategories, using ctx for the request.
+	UpdateCategoriesContext(ctx context.Context, documentId string, categories map[string]string) error
+	// UpdateCategoriesBatch updates the categories for a batch of documents, without affecting their text fields.
+	// Check BulkUpdateResults for status.
+	UpdateCategoriesBatch(updates []CategoryUpdate) (BulkUpdateResults, error)
+	// UpdateCategoriesBatchContext is like UpdateCategoriesBatch, using ctx for the request.
+	UpdateCategoriesBatchContext(ctx context.Context, updates []CategoryUpdate) (BulkUpdateResults, error)
 	// DeleteDocument deletes a document from the search index.
 	DeleteDocument(string) error
+	// DeleteDocumentContext is like DeleteDocument, using ctx for the request.
+	DeleteDocumentContext(ctx context.Context, documentId string) error
 	// DeleteDocuments deletes a batch of documents from the search index. Check BulkDeleteResults for status.
 	DeleteDocuments([]string) (BulkDeleteResults, error)
+	// DeleteDocumentsContext is like DeleteDocuments, using ctx for the request.
+	DeleteDocumentsContext(ctx context.Context, documentIds []string) (BulkDeleteResults, error)
 	// AddFunction sets a custom scoring function for a search index.
 	AddFunction(functionIndex int, definition string) error
+	// AddFunctionContext is like AddFunction, using ctx for the request.
+	AddFunctionContext(ctx context.Context, functionIndex int, definition string) error
 	// DeleteFunction removes a custom scoring function for a search index.
 	DeleteFunction(functionIndex int) error
+	// DeleteFunctionContext is like DeleteFunction, using ctx for the request.
+	DeleteFunctionContext(ctx context.Context, functionIndex int) error
 	// ListFunctions lists all scoring functions for this search index.
 	ListFunctions() (map[string]string, error)
-	// Search performs a search for a simple query string.
-	Search(queryString string) (map[string]interface{}, error)
+	// ListFunctionsContext is like ListFunctions, using ctx for the request.
+	ListFunctionsContext(ctx context.Context) (map[string]string, error)
+	// Search performs a search for a simple query string, with the default Query options.
+	Search(queryString string) (SearchResults, error)
+	// SearchContext is like Search, using ctx for the request.
+	SearchContext(ctx context.Context, queryString string) (SearchResults, error)
 	// SearchWithQuery performs a search for an indextank.Query object.
 	SearchWithQuery(query Query) (SearchResults, error)
-	//DeleteBySearch()
+	// SearchWithQueryContext is like SearchWithQuery, using ctx for the request.
+	SearchWithQueryContext(ctx context.Context, query Query) (SearchResults, error)
+	// DeleteBySearch deletes every document matching query, including its category, docvar and function filters,
+	// and returns the number of deleted documents. Matches skipped with query.Start(n) are kept; the number of
+	// results and the fields to fetch or snippet are ignored.
+	DeleteBySearch(query Query) (int, error)
+	// DeleteBySearchContext is like DeleteBySearch, using ctx for the request.
+	DeleteBySearchContext(ctx context.Context, query Query) (int, error)
 	// GetMetadata returns metadata for a search index.
 	GetMetadata() (map[string]interface{}, error)
+	// GetMetadataContext is like GetMetadata, using ctx for the request.
+	GetMetadataContext(ctx context.Context) (map[string]interface{}, error)
 }
 
 type IndexClient struct {
 	url      string
 	metadata map[string]interface{}
+	conn     *connection
 }
 
 func (client *IndexClient) CreateIndex() error {
-	return client.CreateIndexWithOptions(nil)
+	return client.CreateIndexWithOptionsContext(context.Background(), nil)
+}
+
+func (client *IndexClient) CreateIndexContext(ctx context.Context) error {
+	return client.CreateIndexWithOptionsContext(ctx, nil)
 }
 
 func (client *IndexClient) CreateIndexWithOptions(options map[string]interface{}) error {
+	return client.CreateIndexWithOptionsContext(context.Background(), options)
+}
+
+func (client *IndexClient) CreateIndexWithOptionsContext(ctx context.Context, options map[string]interface{}) error {
 	if options == nil {
 		options = make(map[string]interface{})
 	}
@@ -81,7 +138,7 @@ func (client *IndexClient) CreateIndexWithOptions(options map[string]interface{}
 	//         204 if already existed,
 	//         409 if too many indexes
 
-	resp, err := request("PUT", client.url, options)
+	resp, err := client.conn.request(ctx, OperationAdmin, "PUT", client.url, options)
 	if err != nil {
 		return err
 	}
@@ -90,45 +147,72 @@ func (client *IndexClient) CreateIndexWithOptions(options map[string]interface{}
 	}
 	switch resp.StatusCode {
 	case 201:
-		client.GetMetadata()
+		client.GetMetadataContext(ctx)
 		return nil
 	case 204:
-		return errors.New("Index already exists")
+		return newAPIError(resp, ErrIndexAlreadyExists)
 	case 409:
-		return errors.New("Maximum indexes limit reached for this account")
+		return newAPIError(resp, ErrTooManyIndexes)
 	}
-	return fmt.Errorf("Unexpected error, HTTP status %d: %s", resp.StatusCode, resp.Status)
+	return statusError(OperationAdmin, resp)
 }
 
 func (client *IndexClient) UpdateIndex(options map[string]interface{}) error {
-	resp, err := request("PUT", client.url, options)
-	if resp != nil {
-		defer resp.Body.Close()
+	return client.UpdateIndexContext(context.Background(), options)
+}
+
+func (client *IndexClient) UpdateIndexContext(ctx context.Context, options map[string]interface{}) error {
+	resp, err := client.conn.request(ctx, OperationAdmin, "PUT", client.url, options)
+	if err != nil {
+		return err
 	}
+	defer resp.Body.Close()
 	if isOk(resp.StatusCode) {
-		client.metadata, err = client.refreshMetadata()
+		client.metadata, err = client.refreshMetadata(ctx)
+		if err != nil {
+			return fmt.Errorf("Index updated, but reading its metadata failed: %w", err)
+		}
 		return nil
 	}
-	if resp.StatusCode == 404 {
-		return errors.New("Index does not exist")
-	}
-	return err
+	return statusError(OperationAdmin, resp)
 }
 
 func (client *IndexClient) DeleteIndex() error {
+	return client.DeleteIndexContext(context.Background())
+}
+
+func (client *IndexClient) DeleteIndexContext(ctx context.Context) error {
 	// error: index does not exist, io error
 	// returns 200 if OK, or 204 if no index existed
-	_, err := request("DELETE", client.url, nil)
-	return err
+	resp, err := client.conn.request(ctx, OperationAdmin, "DELETE", client.url, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == 204 {
+		return newAPIError(resp, ErrIndexNotFound)
+	}
+	if isOk(resp.StatusCode) {
+		return nil
+	}
+	return statusError(OperationAdmin, resp)
 }
 
 func (client *IndexClient) Exists() bool {
-	_, err := client.refreshMetadata()
+	return client.ExistsContext(context.Background())
+}
+
+func (client *IndexClient) ExistsContext(ctx context.Context) bool {
+	_, err := client.refreshMetadata(ctx)
 	return err == nil
 }
 
 func (client *IndexClient) HasStarted() bool {
-	client.metadata, _ = client.refreshMetadata()
+	return client.HasStartedContext(context.Background())
+}
+
+func (client *IndexClient) HasStartedContext(ctx context.Context) bool {
+	client.metadata, _ = client.refreshMetadata(ctx)
 	return client.metadata["started"] == true
 }
 
@@ -184,25 +268,36 @@ func (client *IndexClient) getMetadata(s string) (interface{}, error) {
 }
 
 func (client *IndexClient) GetMetadata() (map[string]interface{}, error) {
+	return client.GetMetadataContext(context.Background())
+}
+
+func (client *IndexClient) GetMetadataContext(ctx context.Context) (map[string]interface{}, error) {
 	var err error
 	if client.metadata == nil {
-		client.metadata, err = client.refreshMetadata()
+		client.metadata, err = client.refreshMetadata(ctx)
 	}
 	return client.metadata, err
 }
 
-func (client *IndexClient) refreshMetadata() (map[string]interface{}, error) {
+func (client *IndexClient) refreshMetadata(ctx context.Context) (map[string]interface{}, error) {
 	uri := client.url
-	return doRequest("GET", uri, nil)
+	return client.conn.doRequest(ctx, OperationAdmin, "GET", uri, nil)
 }
 
 func (client *IndexClient) ListFunctions() (map[string]string, error) {
+	return client.ListFunctionsContext(context.Background())
+}
+
+func (client *IndexClient) ListFunctionsContext(ctx context.Context) (map[string]string, error) {
 	functions_url := client.url + "/functions"
-	resp, err := request("GET", functions_url, nil)
+	resp, err := client.conn.request(ctx, OperationFunctions, "GET", functions_url, nil)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if !isOk(resp.StatusCode) {
+		return nil, statusError(OperationFunctions, resp)
+	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if len(body) == 0 {
@@ -215,10 +310,14 @@ func (client *IndexClient) ListFunctions() (map[string]string, error) {
 }
 
 func (client *IndexClient) AddFunction(functionIndex int, definition string) error {
+	return client.AddFunctionContext(context.Background(), functionIndex, definition)
+}
+
+func (client *IndexClient) AddFunctionContext(ctx context.Context, functionIndex int, definition string) error {
 	functions_url := client.url + "/functions/" + strconv.Itoa(functionIndex)
 
 	data := map[string]string{"definition": definition}
-	resp, err := request("PUT", functions_url, data)
+	resp, err := client.conn.request(ctx, OperationFunctions, "PUT", functions_url, data)
 	if err != nil {
 		return err
 	}
@@ -227,25 +326,17 @@ func (client *IndexClient) AddFunction(functionIndex int, definition string) err
 	if isOk(resp.StatusCode) {
 		return nil
 	}
-	if resp.StatusCode == 400 {
-		//body, _ := ioutil.ReadAll(resp.Body)
-		body, _ := readResponseBody(resp)
-		if len(body) > 0 {
-			return errors.New(string(body))
-		}
-		//return errors.New(resp.Status)
-	}
-
-	// other errors:
-	// IndexDoesNotExist
-	// UnexpectedError
-
-	return fmt.Errorf("Unexpected %d error: %s", resp.StatusCode, resp.Status)
+	// a 400 response body describes what is wrong with the definition
+	return statusError(OperationFunctions, resp)
 }
 
 func (client *IndexClient) DeleteFunction(functionIndex int) error {
+	return client.DeleteFunctionContext(context.Background(), functionIndex)
+}
+
+func (client *IndexClient) DeleteFunctionContext(ctx context.Context, functionIndex int) error {
 	functions_url := fmt.Sprintf("%s/functions/%d", client.url, functionIndex)
-	resp, err := request("DELETE", functions_url, nil)
+	resp, err := client.conn.request(ctx, OperationFunctions, "DELETE", functions_url, nil)
 	if err != nil {
 		return err
 	}
@@ -253,31 +344,35 @@ func (client *IndexClient) DeleteFunction(functionIndex int) error {
 	if isOk(resp.StatusCode) {
 		return nil
 	}
-	if resp.StatusCode == 400 {
-		// todo read resp body
-		return errors.New(resp.Status)
-	}
-	return fmt.Errorf("Unexpected %d error: %s", resp.StatusCode, resp.Status)
+	return statusError(OperationFunctions, resp)
 }
 
 func (client *IndexClient) AddDocument(documentId string, fields map[string]string, variables map[int]float32,
 	categories map[string]string) error {
+	return client.AddDocumentContext(context.Background(), documentId, fields, variables, categories)
+}
+
+func (client *IndexClient) AddDocumentContext(ctx context.Context, documentId string, fields map[string]string,
+	variables map[int]float32, categories map[string]string) error {
 	addUrl := client.url + "/docs"
-	// todo - validate len(utf8(docId)) <= 1024
 	data := map[string]interface{}{"docid": documentId, "fields": fields}
+	// convert int keys to strings because the json encoder only supports string keys
+	vars := map[string]float32{}
+	for k, v := range variables {
+		vars[strconv.Itoa(k)] = v
+	}
+	doc := Document{Id: documentId, Fields: fields, Variables: vars, Categories: categories}
+	if err := client.conn.documentLimits().Validate(doc); err != nil {
+		return err
+	}
 	if variables != nil {
-		// convert int keys to strings because the json encoder only supports string keys
-		vars := map[string]float32{}
-		for k, v := range variables {
-			vars[strconv.Itoa(k)] = v
-		}
 		data["variables"] = vars
 	}
 	if categories != nil {
 		data["categories"] = categories
 	}
 	//fmt.Printf("AddDocument data: %v\n", data)
-	resp, err := request("PUT", addUrl, data)
+	resp, err := client.conn.request(ctx, OperationIndexing, "PUT", addUrl, data)
 	if err != nil {
 		return err
 	}
@@ -285,14 +380,7 @@ func (client *IndexClient) AddDocument(documentId string, fields map[string]stri
 	if isOk(resp.StatusCode) {
 		return nil
 	}
-	if resp.StatusCode == 400 {
-		body, _ := ioutil.ReadAll(resp.Body)
-		if len(body) > 0 {
-			return errors.New(string(body))
-		}
-	}
-
-	return errors.New("Unexpected error adding document")
+	return statusError(OperationIndexing, resp)
 }
 
 type Document struct {
@@ -304,19 +392,22 @@ type Document struct {
 
 //type Doc interface{}
 
+// NewDocument returns a Document, checked with ValidateDocument.
 func NewDocument(docid string, fields map[string]string, variables map[int]float32, categories map[string]string) (Document, error) {
 	// convert int keys to strings because the json encoder only supports string keys
 	vars := map[string]float32{}
 	for k, v := range variables {
 		vars[strconv.Itoa(k)] = v
 	}
-	// todo - validate len(utf8(docId)) <= 1024
 	doc := Document{
 		Id:         docid,
 		Fields:     fields,
 		Variables:  vars,
 		Categories: categories,
 	}
+	if err := ValidateDocument(doc); err != nil {
+		return Document{}, err
+	}
 	return doc, nil
 }
 
@@ -326,15 +417,34 @@ type addResult struct {
 }
 
 func (client *IndexClient) AddDocuments(documents []Document) (BatchResults, error) {
+	return client.AddDocumentsContext(context.Background(), documents)
+}
+
+func (client *IndexClient) AddDocumentsContext(ctx context.Context, documents []Document) (BatchResults, error) {
 	addUrl := client.url + "/docs"
 
 	// request body is a JSON list of documents, e.g.:
 	// [ { "docid":"123", "fields": {"text","testing","title":"heya"}, "variables":{0:1}, "categories":{"type":"val"} } ]
 
-	// todo - validate len(utf8(docId)) <= 1024
+	// invalid documents are not sent, they fail with the validation error
+	results := make([]addResult, len(documents))
+	valid := make([]Document, 0, len(documents))
+	positions := make([]int, 0, len(documents))
+	limits := client.conn.documentLimits()
+	for i, doc := range documents {
+		if err := limits.Validate(doc); err != nil {
+			results[i] = addResult{Added: false, Error: err.Error()}
+			continue
+		}
+		valid = append(valid, doc)
+		positions = append(positions, i)
+	}
+	if len(valid) == 0 && len(documents) > 0 {
+		return newBatchResults(documents, results), nil
+	}
 
 	//fmt.Printf("AddDocuments data: %v\n", documents)
-	resp, err := request("PUT", addUrl, documents)
+	resp, err := client.conn.request(ctx, OperationIndexing, "PUT", addUrl, valid)
 	if err != nil {
 		return nil, err
 	}
@@ -353,27 +463,27 @@ func (client *IndexClient) AddDocuments(documents []Document) (BatchResults, err
 			//fmt.Printf("Error unmarshalling bulk add: %v\n", err)
 			return nil, err
 		}
-		if len(documents) != len(r) {
+		if len(valid) != len(r) {
 			// something went wonky
-			return nil, fmt.Errorf("Something is wrong, we have %d docs and %d results\n", len(documents), len(r))
+			return nil, fmt.Errorf("Something is wrong, we have %d docs and %d results\n", len(valid), len(r))
 		}
 		//fmt.Printf("Bulk add unmarshalled results: %v\n", r)
-		bd := newBatchResults(documents, r)
+		for j, i := range positions {
+			results[i] = r[j]
+		}
+		bd := newBatchResults(documents, results)
 		//fmt.Printf("Failed docids: %v\n", bd.GetFailedDocuments())
 		return bd, nil
 	}
 
-	if resp.StatusCode == 400 {
-		body, _ := ioutil.ReadAll(resp.Body)
-		if len(body) > 0 {
-			return nil, errors.New(string(body))
-		}
-	}
-
-	return nil, errors.New("Unexpected error adding documents batch")
+	return nil, statusError(OperationIndexing, resp)
 }
 
 func (c *IndexClient) UpdateVariables(documentId string, variables map[int]float32) error {
+	return c.UpdateVariablesContext(context.Background(), documentId, variables)
+}
+
+func (c *IndexClient) UpdateVariablesContext(ctx context.Context, documentId string, variables map[int]float32) error {
 	updateUrl := c.url + "/docs/variables"
 
 	// convert int keys to strings because the json encoder only supports string keys
@@ -383,7 +493,7 @@ func (c *IndexClient) UpdateVariables(documentId string, variables map[int]float
 	}
 	data := map[string]interface{}{"docid": documentId, "variables": vars}
 	//fmt.Printf("UpdateVariables data: %v\n", data)
-	resp, err := request("PUT", updateUrl, data)
+	resp, err := c.conn.request(ctx, OperationIndexing, "PUT", updateUrl, data)
 	if err != nil {
 		return err
 	}
@@ -391,25 +501,90 @@ func (c *IndexClient) UpdateVariables(documentId string, variables map[int]float
 	if isOk(resp.StatusCode) {
 		return nil
 	}
-	if resp.StatusCode == 400 {
-		body, _ := ioutil.ReadAll(resp.Body)
-		// todo - do this anytime we have an error (read the body)
-		if len(body) > 0 {
-			return errors.New(string(body))
-		}
+	return statusError(OperationIndexing, resp)
+}
+
+func (c *IndexClient) UpdateCategories(documentId string, categories map[string]string) error {
+	return c.UpdateCategoriesContext(context.Background(), documentId, categories)
+}
+
+func (c *IndexClient) UpdateCategoriesContext(ctx context.Context, documentId string, categories map[string]string) error {
+	categoriesUrl := c.url + "/docs/categories"
+
+	if categories == nil {
+		categories = map[string]string{}
+	}
+	data := CategoryUpdate{Id: documentId, Categories: categories}
+	resp, err := c.conn.request(ctx, OperationIndexing, "PUT", categoriesUrl, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if isOk(resp.StatusCode) {
+		return nil
 	}
+	return statusError(OperationIndexing, resp)
+}
 
-	return errors.New("Unexpected error updating variables")
+// CategoryUpdate holds the new categories of one document, for Index.UpdateCategoriesBatch.
+type CategoryUpdate struct {
+	Id         string            `json:"docid"`
+	Categories map[string]string `json:"categories"`
 }
 
-func (c *IndexClient) UpdateCategories(documentId string, categories map[string]string) error {
-	//categoriesUrl := c.url + "/docs/categories"
-	return errors.New("UpdateCategories not yet implemented")
+type updateResult struct {
+	Updated bool   `json:"updated"`
+	Error   string `json:"error"`
+}
+
+func (c *IndexClient) UpdateCategoriesBatch(updates []CategoryUpdate) (BulkUpdateResults, error) {
+	return c.UpdateCategoriesBatchContext(context.Background(), updates)
+}
+
+func (c *IndexClient) UpdateCategoriesBatchContext(ctx context.Context, updates []CategoryUpdate) (BulkUpdateResults, error) {
+	categoriesUrl := c.url + "/docs/categories"
+
+	// request body is a JSON list like:
+	// [ {"docid":"123", "categories":{"color":"red"}}, {"docid":"234", "categories":{"color":"blue"}} ]
+	data := make([]CategoryUpdate, len(updates))
+	documentIds := make([]string, len(updates))
+	for i, u := range updates {
+		if u.Categories == nil {
+			u.Categories = map[string]string{}
+		}
+		data[i] = u
+		documentIds[i] = u.Id
+	}
+
+	resp, err := c.conn.request(ctx, OperationIndexing, "PUT", categoriesUrl, data)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if isOk(resp.StatusCode) {
+		// response body will be a JSON list e.g.
+		// [ {"updated":true }, {"updated":false, "error":"something"} ]
+		body, _ := ioutil.ReadAll(resp.Body)
+		r := make([]updateResult, 0)
+		err := json.Unmarshal(body, &r)
+		if err != nil {
+			return nil, err
+		}
+		if len(updates) != len(r) {
+			return nil, fmt.Errorf("Something is wrong, we have %d updates and %d results\n", len(updates), len(r))
+		}
+		return newUpdateResults(documentIds, r), nil
+	}
+	return nil, statusError(OperationIndexing, resp)
 }
 
 func (client *IndexClient) DeleteDocument(documentId string) error {
+	return client.DeleteDocumentContext(context.Background(), documentId)
+}
+
+func (client *IndexClient) DeleteDocumentContext(ctx context.Context, documentId string) error {
 	docs_url := client.url + "/docs?docid=" + url.QueryEscape(documentId)
-	resp, err := request("DELETE", docs_url, nil)
+	resp, err := client.conn.request(ctx, OperationIndexing, "DELETE", docs_url, nil)
 	if err != nil {
 		return err
 	}
@@ -417,10 +592,7 @@ func (client *IndexClient) DeleteDocument(documentId string) error {
 	if isOk(resp.StatusCode) {
 		return nil
 	}
-	if resp.StatusCode == 404 {
-		return errors.New("Index does not exist")
-	}
-	return fmt.Errorf("Unexpected %d error: %s", resp.StatusCode, resp.Status)
+	return statusError(OperationIndexing, resp)
 }
 
 // used in DeleteDocuments
@@ -434,6 +606,10 @@ type deleteResult struct {
 }
 
 func (client *IndexClient) DeleteDocuments(documentIds []string) (BulkDeleteResults, error) {
+	return client.DeleteDocumentsContext(context.Background(), documentIds)
+}
+
+func (client *IndexClient) DeleteDocumentsContext(ctx context.Context, documentIds []string) (BulkDeleteResults, error) {
 	// request body should be JSON list like:
 	// [ {"docid":"123"}, {"docid":"234"} ]
 
@@ -444,7 +620,7 @@ func (client *IndexClient) DeleteDocuments(documentIds []string) (BulkDeleteResu
 	}
 
 	docs_url := client.url + "/docs"
-	resp, err := request("DELETE", docs_url, docs)
+	resp, err := client.conn.request(ctx, OperationIndexing, "DELETE", docs_url, docs)
 	if err != nil {
 		return nil, err
 	}
@@ -461,14 +637,14 @@ func (client *IndexClient) DeleteDocuments(documentIds []string) (BulkDeleteResu
 		if err != nil {
 			return nil, err
 		}
+		if len(documentIds) != len(r) {
+			return nil, fmt.Errorf("Something is wrong, we have %d docids and %d results\n", len(documentIds), len(r))
+		}
 		bd := newBulkResults(documentIds, r)
 		//fmt.Printf("Failed docids: %v\n", bd.GetFailedDocids())
 		return bd, nil
 	}
-	if resp.StatusCode == 404 {
-		return nil, errors.New("Index does not exist")
-	}
-	return nil, fmt.Errorf("Unexpected %d error: %s", resp.StatusCode, resp.Status)
+	return nil, statusError(OperationIndexing, resp)
 }
 
 type searchResults struct {
@@ -479,15 +655,26 @@ type searchResults struct {
 	DidYouMean *string                   `json:"didyoumean,omitempty"`
 	Results    []map[string]interface{}  `json:"results,omitempty"`
 	Facets     map[string]map[string]int `json:"facets,omitempty"`
+	hits       []Hit
 }
 
 type SearchResults interface {
+	// GetResults returns the results as returned by the server.
 	GetResults() []map[string]interface{}
+	// GetHits returns the results as Hits, with document ids, scores, fields, variables, categories and snippets
+	// taken out of the raw results.
+	GetHits() []Hit
 	GetMatches() int64
 	GetQuery() string
 	GetFacets() map[string]map[string]int
 	GetSearchTime() float32
 	GetDidYouMean() string
+	// Decode stores the hits in the slice of structs, or of pointers to structs, pointed to by v,
+	// replacing its contents. See Hit.Decode for how hits are mapped to structs:
+	//
+	//	var products []Product
+	//	err := results.Decode(&products)
+	Decode(v interface{}) error
 }
 
 func (r *searchResults) GetMatches() int64 {
@@ -507,17 +694,43 @@ func (r *searchResults) GetDidYouMean() string {
 func (r *searchResults) GetResults() []map[string]interface{} {
 	return r.Results
 }
+func (r *searchResults) GetHits() []Hit {
+	return r.hits
+}
 func (r *searchResults) GetFacets() map[string]map[string]int {
 	return r.Facets
 }
 
+func decodeSearchResults(body []byte) (*searchResults, error) {
+	sr := new(searchResults)
+	err := json.Unmarshal(body, sr)
+	if err != nil {
+		//fmt.Printf("Error unmarshalling searchResults: %v\n", err)
+		return nil, err
+	}
+	//fmt.Printf("SearchResults object: %v\n", sr)
+	if sr.DidYouMean == nil {
+		empty := ""
+		sr.DidYouMean = &empty
+	}
+	sr.hits = make([]Hit, len(sr.Results))
+	for i, result := range sr.Results {
+		sr.hits[i] = newHit(result)
+	}
+	return sr, nil
+}
+
 //func (client *IndexClient) SearchWithQuery(query Query) (map[string]interface{}, error) {
 func (client *IndexClient) SearchWithQuery(query Query) (SearchResults, error) {
+	return client.SearchWithQueryContext(context.Background(), query)
+}
+
+func (client *IndexClient) SearchWithQueryContext(ctx context.Context, query Query) (SearchResults, error) {
 	searchUrl := client.url + "/search"
 	params := query.ToQueryParams()
 	searchUrl += "?" + params
 	//fmt.Printf(" search URL: %s\n", searchUrl)
-	resp, err := request("GET", searchUrl, nil)
+	resp, err := client.conn.request(ctx, OperationSearch, "GET", searchUrl, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -532,37 +745,62 @@ func (client *IndexClient) SearchWithQuery(query Query) (SearchResults, error) {
 				//fmt.Printf("Error unmarshalling searchResults: %v\n", err)
 				return nil, err
 			} */
-		sr := new(searchResults)
-		err = json.Unmarshal(body, sr)
+		sr, err := decodeSearchResults(body)
 		if err != nil {
-			//fmt.Printf("Error unmarshalling searchResults: %v\n", err)
 			return nil, err
 		}
-		//fmt.Printf("SearchResults object: %v\n", sr)
-		if sr.DidYouMean == nil {
-			empty := ""
-			sr.DidYouMean = &empty
-		}
 		return sr, nil
 	}
-	// todo handle other HTTP statuses
-	if resp.StatusCode == 404 {
-		return nil, errors.New("Index does not exist")
-	} else {
-		body, _ := ioutil.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Unexpected %d error: %s", resp.StatusCode, body)
+	return nil, statusError(OperationSearch, resp)
+}
+
+func (client *IndexClient) DeleteBySearch(query Query) (int, error) {
+	return client.DeleteBySearchContext(context.Background(), query)
+}
+
+func (client *IndexClient) DeleteBySearchContext(ctx context.Context, query Query) (int, error) {
+	searchUrl := client.url + "/search?" + deleteBySearchParams(query)
+	resp, err := client.conn.request(ctx, OperationIndexing, "DELETE", searchUrl, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if !isOk(resp.StatusCode) {
+		return 0, statusError(OperationSearch, resp)
+	}
+
+	// response body will be a JSON object e.g. {"deleted": 12}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil || len(body) == 0 {
+		return 0, err
+	}
+	var r struct {
+		Deleted int `json:"deleted"`
+	}
+	err = json.Unmarshal(body, &r)
+	return r.Deleted, err
+}
+
+// deleteBySearchParams returns the parameters of query that a DELETE to the search url takes, e.g. q,
+// start, function, category_filters and filter_docvarN. It deletes every match from start on, so the
+// page length, like the fetched and snippet fields, is left out.
+func deleteBySearchParams(query Query) string {
+	params, _ := url.ParseQuery(query.ToQueryParams())
+	for _, k := range []string{"len", "fetch", "fetch_variables", "fetch_categories", "snippet"} {
+		params.Del(k)
 	}
-	return nil, fmt.Errorf("Unexpected %d error: %s", resp.StatusCode, resp.Status)
+	return params.Encode()
 }
 
-func (client *IndexClient) Search(queryString string) (map[string]interface{}, error) {
+func (client *IndexClient) Search(queryString string) (SearchResults, error) {
+	return client.SearchContext(context.Background(), queryString)
+}
+
+func (client *IndexClient) SearchContext(ctx context.Context, queryString string) (SearchResults, error) {
 	// search(self, query, start=None, length=None, scoring_function=None, snippet_fields=None,
 	// fetch_fields=None, category_filters=None, variables=None, docvar_filters=None, function_filters=None,
 	// fetch_variables=None, fetch_categories=None):
-	searchUrl := client.url + "/search"
-	//fmt.Printf(" search URL: %s\n", searchUrl)
-	params := map[string]string{"q": queryString}
-	return doRequest("GET", searchUrl, params)
+	return client.SearchWithQueryContext(ctx, QueryForString(queryString))
 }
 
 const iSO8601Format = "2006-01-02T15:04:05"
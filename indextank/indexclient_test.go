@@ -0,0 +1,173 @@
+package indextank
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// recordedRequest is a request received by a server from newRecordingServer.
+type recordedRequest struct {
+	method, path, query string
+	body                []byte
+}
+
+// newRecordingServer returns a server answering every request with response, and an Index
+// for it. The requests it receives are sent to the returned channel.
+func newRecordingServer(t *testing.T, response string) (Index, <-chan recordedRequest) {
+	t.Helper()
+	requests := make(chan recordedRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- recordedRequest{r.Method, r.URL.Path, r.URL.RawQuery, body}
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(srv.Close)
+	client, err := NewApiClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client.GetIndex("test"), requests
+}
+
+func TestUpdateCategories(t *testing.T) {
+	idx, requests := newRecordingServer(t, "")
+	tests := []struct {
+		categories map[string]string
+		want       string
+	}{
+		{map[string]string{"color": "red"}, `{"docid":"doc1","categories":{"color":"red"}}`},
+		{nil, `{"docid":"doc1","categories":{}}`},
+	}
+	for _, test := range tests {
+		if err := idx.UpdateCategories("doc1", test.categories); err != nil {
+			t.Fatal(err)
+		}
+		req := <-requests
+		if req.method != "PUT" || req.path != "/v1/indexes/test/docs/categories" || string(req.body) != test.want {
+			t.Errorf("UpdateCategories(%v) sent %s %s %s, want body %s", test.categories, req.method, req.path, req.body, test.want)
+		}
+	}
+}
+
+func TestUpdateCategoriesBatch(t *testing.T) {
+	idx, requests := newRecordingServer(t, `[{"updated": true}, {"updated": false, "error": "no such doc"}, {"updated": true}]`)
+	updates := []CategoryUpdate{
+		{Id: "a", Categories: map[string]string{"color": "red"}},
+		{Id: "b", Categories: map[string]string{"color": "blue", "size": "xl"}},
+		{Id: "c"},
+	}
+	results, err := idx.UpdateCategoriesBatch(updates)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-requests
+	var sent []CategoryUpdate
+	if err := json.Unmarshal(req.body, &sent); err != nil {
+		t.Fatalf("request body %s: %v", req.body, err)
+	}
+	updates[2].Categories = map[string]string{}
+	if req.method != "PUT" || req.path != "/v1/indexes/test/docs/categories" || !reflect.DeepEqual(sent, updates) {
+		t.Errorf("UpdateCategoriesBatch sent %s %s %s", req.method, req.path, req.body)
+	}
+
+	if !results.HasErrors() || !reflect.DeepEqual(results.GetFailedDocids(), []string{"b"}) {
+		t.Errorf("HasErrors %v, failed docids %v, want [b]", results.HasErrors(), results.GetFailedDocids())
+	}
+	for i, want := range []bool{true, false, true} {
+		if results.GetResult(i) != want || results.GetDocid(i) != updates[i].Id {
+			t.Errorf("result %d: %v for %s, want %v for %s", i, results.GetResult(i), results.GetDocid(i), want, updates[i].Id)
+		}
+	}
+	if msg, ok := results.GetErrorMessage(1); !ok || msg != "no such doc" {
+		t.Errorf("GetErrorMessage(1) = %q, %v", msg, ok)
+	}
+	if _, ok := results.GetErrorMessage(0); ok {
+		t.Error("GetErrorMessage(0) reported an error for a successful update")
+	}
+}
+
+func TestUpdateCategoriesBatchWrongResults(t *testing.T) {
+	for _, response := range []string{`[{"updated": true}]`, `[]`, `{"updated": true}`} {
+		idx, _ := newRecordingServer(t, response)
+		if _, err := idx.UpdateCategoriesBatch([]CategoryUpdate{{Id: "a"}, {Id: "b"}}); err == nil {
+			t.Errorf("UpdateCategoriesBatch accepted the response %s for 2 updates", response)
+		}
+	}
+}
+
+func TestDeleteBySearchParams(t *testing.T) {
+	idx, requests := newRecordingServer(t, `{"deleted": 3}`)
+	query := QueryForString("hello")
+	query.Start(5)
+	query.NumResults(1)
+	query.FetchFields("text")
+	query.SnippetFields("text")
+	query.FetchVariables()
+	query.FetchCategories()
+	query.ScoringFunction(2)
+	query.CategoryFilter(map[string][]string{"color": {"red"}})
+	query.DocumentVariableFilter(0, 1, 2)
+
+	deleted, err := idx.DeleteBySearch(query)
+	if err != nil || deleted != 3 {
+		t.Errorf("DeleteBySearch = %d, %v, want 3", deleted, err)
+	}
+	req := <-requests
+	want := "category_filters=%7B%22color%22%3A%5B%22red%22%5D%7D&filter_docvar0=1%3A2&function=2&q=hello&start=5"
+	if req.method != "DELETE" || req.path != "/v1/indexes/test/search" || req.query != want {
+		t.Errorf("DeleteBySearch sent %s %s?%s, want DELETE /v1/indexes/test/search?%s", req.method, req.path, req.query, want)
+	}
+
+	// MemoryIndex agrees: the number of results doesn't limit the deletes
+	mem := NewMemoryIndex()
+	for _, docid := range []string{"a", "b", "c", "d"} {
+		if err := mem.AddDocument(docid, map[string]string{"text": "hello"}, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	query = QueryForString("hello")
+	query.Start(1)
+	query.NumResults(1)
+	if deleted, err := mem.DeleteBySearch(query); err != nil || deleted != 3 {
+		t.Errorf("MemoryIndex.DeleteBySearch = %d, %v, want 3", deleted, err)
+	}
+}
+
+func TestSearchResults(t *testing.T) {
+	idx, requests := newRecordingServer(t, `{"matches": 12, "search_time": "0.004", "query": "cats OR dogs",
+		"didyoumean": "cats or dogs", "facets": {"color": {"red": 3, "blue": 9}}, "results": [{"docid": "a"}]}`)
+	results, err := idx.Search("cats OR dogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req := <-requests; req.path != "/v1/indexes/test/search" || req.query != "len=10&q=cats+OR+dogs" {
+		t.Errorf("Search sent %s?%s", req.path, req.query)
+	}
+	if results.GetMatches() != 12 || results.GetQuery() != "cats OR dogs" || results.GetDidYouMean() != "cats or dogs" {
+		t.Errorf("matches %d, query %q, did you mean %q", results.GetMatches(), results.GetQuery(), results.GetDidYouMean())
+	}
+	if got := results.GetSearchTime(); got != 0.004 {
+		t.Errorf("GetSearchTime() = %v, want 0.004", got)
+	}
+	if facets := results.GetFacets(); !reflect.DeepEqual(facets, map[string]map[string]int{"color": {"red": 3, "blue": 9}}) {
+		t.Errorf("GetFacets() = %v", facets)
+	}
+	if hits := results.GetHits(); len(hits) != 1 || hits[0].Docid != "a" {
+		t.Errorf("GetHits() = %+v", hits)
+	}
+
+	// didyoumean may be null
+	idx, _ = newRecordingServer(t, `{"matches": 0, "search_time": "0.001", "didyoumean": null, "results": []}`)
+	results, err = idx.Search("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results.GetDidYouMean() != "" || len(results.GetHits()) != 0 {
+		t.Errorf("did you mean %q, %d hits", results.GetDidYouMean(), len(results.GetHits()))
+	}
+}
@@ -0,0 +1,428 @@
+package indextanktest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/searchify/gotank/indextank"
+)
+
+// IndexFactory returns a new, empty, started index for a test. It can use t to clean up afterwards.
+type IndexFactory func(t *testing.T) indextank.Index
+
+// RunIndexConformance checks that the indexes returned by factory behave like an IndexClient,
+// running each check as a subtest with a new index:
+//
+//	func TestMyIndex(t *testing.T) {
+//		indextanktest.RunIndexConformance(t, func(t *testing.T) indextank.Index {
+//			return mycache.Wrap(indextank.NewMemoryIndex())
+//		})
+//	}
+//
+// Indexes created through a Server's ApiClient pass it, as does an indextank.MemoryIndex.
+// The checks only rely on documented semantics, and not on relevance scores.
+func RunIndexConformance(t *testing.T, factory IndexFactory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, idx indextank.Index)
+	}{
+		{"Exists", testExists},
+		{"AddDocument", testAddDocument},
+		{"AddDocumentReplaces", testAddDocumentReplaces},
+		{"AddDocuments", testAddDocuments},
+		{"DeleteDocument", testDeleteDocument},
+		{"DeleteDocuments", testDeleteDocuments},
+		{"DeleteBySearch", testDeleteBySearch},
+		{"UpdateVariables", testUpdateVariables},
+		{"UpdateCategories", testUpdateCategories},
+		{"UpdateCategoriesBatch", testUpdateCategoriesBatch},
+		{"CategoryFilters", testCategoryFilters},
+		{"VariableFilters", testVariableFilters},
+		{"Paging", testPaging},
+		{"Functions", testFunctions},
+		{"InvalidQuery", testInvalidQuery},
+		{"CanceledContext", testCanceledContext},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, factory(t))
+		})
+	}
+}
+
+// rankFunction is the number of the scoring function ranking documents by variable 0, set up by addRanked.
+const rankFunction = 5
+
+func doc(docid, text string, rank float32, categories map[string]string) indextank.Document {
+	d, _ := indextank.NewDocument(docid, map[string]string{"text": text}, map[int]float32{0: rank}, categories)
+	return d
+}
+
+// addRanked adds documents, all matching "conformance", ranked by their variable 0 with rankFunction.
+func addRanked(t *testing.T, idx indextank.Index, docs ...indextank.Document) {
+	t.Helper()
+	if err := idx.AddFunction(rankFunction, "doc.var[0]"); err != nil {
+		t.Fatalf("AddFunction: %v", err)
+	}
+	results, err := idx.AddDocuments(docs)
+	if err != nil {
+		t.Fatalf("AddDocuments: %v", err)
+	}
+	if results.HasErrors() {
+		t.Fatalf("AddDocuments failed for %v", results.GetFailedDocuments())
+	}
+}
+
+// search runs a query ranked by rankFunction.
+func search(t *testing.T, idx indextank.Index, q string, setup ...func(indextank.Query)) indextank.SearchResults {
+	t.Helper()
+	query := indextank.QueryForString(q).ScoringFunction(rankFunction)
+	for _, f := range setup {
+		f(query)
+	}
+	results, err := idx.SearchWithQuery(query)
+	if err != nil {
+		t.Fatalf("SearchWithQuery(%q): %v", q, err)
+	}
+	return results
+}
+
+func docids(results indextank.SearchResults) []string {
+	ids := []string{}
+	for _, hit := range results.GetHits() {
+		ids = append(ids, hit.Docid)
+	}
+	return ids
+}
+
+func expectDocids(t *testing.T, results indextank.SearchResults, want ...string) {
+	t.Helper()
+	if got := docids(results); len(got)+len(want) > 0 && !reflect.DeepEqual(got, want) {
+		t.Errorf("got documents %v, want %v", got, want)
+	}
+	if results.GetMatches() != int64(len(want)) {
+		t.Errorf("got %d matches, want %d", results.GetMatches(), len(want))
+	}
+}
+
+func testExists(t *testing.T, idx indextank.Index) {
+	if !idx.Exists() {
+		t.Error("Exists() = false for a new index")
+	}
+	if !idx.HasStarted() {
+		t.Error("HasStarted() = false for a new index")
+	}
+	if _, err := idx.GetMetadata(); err != nil {
+		t.Errorf("GetMetadata: %v", err)
+	}
+}
+
+func testAddDocument(t *testing.T, idx indextank.Index) {
+	fields := map[string]string{"text": "conformance hello", "title": "The title"}
+	if err := idx.AddDocument("doc1", fields, map[int]float32{0: 1, 2: 7.5}, map[string]string{"color": "red"}); err != nil {
+		t.Fatalf("AddDocument: %v", err)
+	}
+	query := indextank.QueryForString("hello")
+	query.FetchFields("title")
+	query.FetchVariables()
+	query.FetchCategories()
+	results, err := idx.SearchWithQuery(query)
+	if err != nil {
+		t.Fatalf("SearchWithQuery: %v", err)
+	}
+	expectDocids(t, results, "doc1")
+	if len(results.GetHits()) != 1 {
+		return
+	}
+	hit := results.GetHits()[0]
+	if hit.Fields["title"] != "The title" {
+		t.Errorf("fetched title = %q, want %q", hit.Fields["title"], "The title")
+	}
+	if hit.Variables[0] != 1 || hit.Variables[2] != 7.5 {
+		t.Errorf("fetched variables = %v, want map[0:1 2:7.5]", hit.Variables)
+	}
+	if hit.Categories["color"] != "red" {
+		t.Errorf("fetched categories = %v, want map[color:red]", hit.Categories)
+	}
+	if results.GetFacets()["color"]["red"] != 1 {
+		t.Errorf("facets = %v, want map[color:map[red:1]]", results.GetFacets())
+	}
+}
+
+func testAddDocumentReplaces(t *testing.T, idx indextank.Index) {
+	addRanked(t, idx, doc("doc1", "conformance before", 1, nil))
+	addRanked(t, idx, doc("doc1", "conformance after", 1, nil))
+	expectDocids(t, search(t, idx, "before"))
+	expectDocids(t, search(t, idx, "after"), "doc1")
+}
+
+func testAddDocuments(t *testing.T, idx indextank.Index) {
+	docs := []indextank.Document{
+		doc("doc1", "conformance", 3, nil),
+		{Id: "doc2"}, // no fields
+		doc("doc3", "conformance", 2, nil),
+		doc("doc4", "conformance", 1, nil),
+	}
+	results, err := idx.AddDocuments(docs)
+	if err != nil {
+		t.Fatalf("AddDocuments: %v", err)
+	}
+	if !results.HasErrors() {
+		t.Error("HasErrors() = false with an invalid document")
+	}
+	for i, want := range []bool{true, false, true, true} {
+		if got := results.GetResult(i); got != want {
+			t.Errorf("GetResult(%d) = %v, want %v", i, got, want)
+		}
+		if got := results.GetDocument(i).Id; got != docs[i].Id {
+			t.Errorf("GetDocument(%d) = %q, want %q", i, got, docs[i].Id)
+		}
+		if _, failed := results.GetErrorMessage(i); failed == want {
+			t.Errorf("GetErrorMessage(%d) reports failure %v, want %v", i, failed, !want)
+		}
+	}
+	if failed := results.GetFailedDocuments(); len(failed) != 1 || failed[0].Id != "doc2" {
+		t.Errorf("GetFailedDocuments() = %v, want doc2 only", failed)
+	}
+
+	if err := idx.AddFunction(rankFunction, "doc.var[0]"); err != nil {
+		t.Fatalf("AddFunction: %v", err)
+	}
+	expectDocids(t, search(t, idx, "conformance"), "doc1", "doc3", "doc4")
+}
+
+func testDeleteDocument(t *testing.T, idx indextank.Index) {
+	addRanked(t, idx, doc("doc1", "conformance", 2, nil), doc("doc2", "conformance", 1, nil))
+	if err := idx.DeleteDocument("doc1"); err != nil {
+		t.Fatalf("DeleteDocument: %v", err)
+	}
+	expectDocids(t, search(t, idx, "conformance"), "doc2")
+	// deleting a missing document is not an error
+	if err := idx.DeleteDocument("doc1"); err != nil {
+		t.Errorf("DeleteDocument of a missing document: %v", err)
+	}
+}
+
+func testDeleteDocuments(t *testing.T, idx indextank.Index) {
+	addRanked(t, idx, doc("doc1", "conformance", 3, nil), doc("doc2", "conformance", 2, nil), doc("doc3", "conformance", 1, nil))
+	ids := []string{"doc3", "missing", "doc1"}
+	results, err := idx.DeleteDocuments(ids)
+	if err != nil {
+		t.Fatalf("DeleteDocuments: %v", err)
+	}
+	if results.HasErrors() {
+		t.Errorf("DeleteDocuments failed for %v", results.GetFailedDocids())
+	}
+	for i, id := range ids {
+		if !results.GetResult(i) {
+			t.Errorf("GetResult(%d) = false, want true", i)
+		}
+		if got := results.GetDocid(i); got != id {
+			t.Errorf("GetDocid(%d) = %q, want %q", i, got, id)
+		}
+	}
+	expectDocids(t, search(t, idx, "conformance"), "doc2")
+}
+
+func testDeleteBySearch(t *testing.T, idx indextank.Index) {
+	addRanked(t, idx, doc("doc1", "conformance red", 3, nil), doc("doc2", "conformance blue", 2, nil), doc("doc3", "conformance red", 1, nil))
+	deleted, err := idx.DeleteBySearch(indextank.QueryForString("red"))
+	if err != nil {
+		t.Fatalf("DeleteBySearch: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("DeleteBySearch deleted %d documents, want 2", deleted)
+	}
+	expectDocids(t, search(t, idx, "conformance"), "doc2")
+}
+
+func testUpdateVariables(t *testing.T, idx indextank.Index) {
+	addRanked(t, idx, doc("doc1", "conformance", 2, nil), doc("doc2", "conformance", 1, nil))
+	if err := idx.UpdateVariables("doc2", map[int]float32{0: 3}); err != nil {
+		t.Fatalf("UpdateVariables: %v", err)
+	}
+	expectDocids(t, search(t, idx, "conformance"), "doc2", "doc1")
+}
+
+func testUpdateCategories(t *testing.T, idx indextank.Index) {
+	addRanked(t, idx, doc("doc1", "conformance", 2, map[string]string{"color": "red"}), doc("doc2", "conformance", 1, map[string]string{"color": "red"}))
+	if err := idx.UpdateCategories("doc2", map[string]string{"color": "blue"}); err != nil {
+		t.Fatalf("UpdateCategories: %v", err)
+	}
+	results := search(t, idx, "conformance", func(q indextank.Query) {
+		q.CategoryFilter(map[string][]string{"color": {"blue"}})
+	})
+	expectDocids(t, results, "doc2")
+}
+
+func testUpdateCategoriesBatch(t *testing.T, idx indextank.Index) {
+	addRanked(t, idx, doc("doc1", "conformance", 2, nil), doc("doc2", "conformance", 1, nil))
+	updates := []indextank.CategoryUpdate{
+		{Id: "doc2", Categories: map[string]string{"size": "small"}},
+		{Id: "doc1", Categories: map[string]string{"size": "large"}},
+	}
+	results, err := idx.UpdateCategoriesBatch(updates)
+	if err != nil {
+		t.Fatalf("UpdateCategoriesBatch: %v", err)
+	}
+	for i, u := range updates {
+		if !results.GetResult(i) {
+			t.Errorf("GetResult(%d) = false, want true", i)
+		}
+		if got := results.GetDocid(i); got != u.Id {
+			t.Errorf("GetDocid(%d) = %q, want %q", i, got, u.Id)
+		}
+	}
+	results2 := search(t, idx, "conformance", func(q indextank.Query) {
+		q.CategoryFilter(map[string][]string{"size": {"large"}})
+	})
+	expectDocids(t, results2, "doc1")
+}
+
+func testCategoryFilters(t *testing.T, idx indextank.Index) {
+	addRanked(t, idx,
+		doc("doc1", "conformance", 4, map[string]string{"color": "red", "size": "small"}),
+		doc("doc2", "conformance", 3, map[string]string{"color": "blue", "size": "small"}),
+		doc("doc3", "conformance", 2, map[string]string{"color": "green", "size": "large"}),
+		doc("doc4", "conformance", 1, nil))
+
+	// values of one category are OR'ed, categories are AND'ed
+	results := search(t, idx, "conformance", func(q indextank.Query) {
+		q.CategoryFilter(map[string][]string{"color": {"red", "green"}})
+	})
+	expectDocids(t, results, "doc1", "doc3")
+	results = search(t, idx, "conformance", func(q indextank.Query) {
+		q.CategoryFilter(map[string][]string{"color": {"red", "blue"}, "size": {"small"}})
+	})
+	expectDocids(t, results, "doc1", "doc2")
+
+	facets := search(t, idx, "conformance").GetFacets()
+	want := map[string]map[string]int{
+		"color": {"red": 1, "blue": 1, "green": 1},
+		"size":  {"small": 2, "large": 1},
+	}
+	if !reflect.DeepEqual(facets, want) {
+		t.Errorf("facets = %v, want %v", facets, want)
+	}
+}
+
+func testVariableFilters(t *testing.T, idx indextank.Index) {
+	addRanked(t, idx, doc("doc1", "conformance", 30, nil), doc("doc2", "conformance", 20, nil), doc("doc3", "conformance", 10, nil))
+	results := search(t, idx, "conformance", func(q indextank.Query) {
+		q.DocumentVariableFilter(0, 15, 25)
+	})
+	expectDocids(t, results, "doc2")
+	results = search(t, idx, "conformance", func(q indextank.Query) {
+		q.DocumentVariableFilter(0, 0, 15)
+		q.DocumentVariableFilter(0, 25, 35)
+	})
+	expectDocids(t, results, "doc1", "doc3")
+	results = search(t, idx, "conformance", func(q indextank.Query) {
+		q.DocumentVariableRanges(0, indextank.AtLeast(20))
+	})
+	expectDocids(t, results, "doc1", "doc2")
+	results = search(t, idx, "conformance", func(q indextank.Query) {
+		q.FunctionFilter(rankFunction, 20, 30)
+	})
+	expectDocids(t, results, "doc1", "doc2")
+	results = search(t, idx, "conformance", func(q indextank.Query) {
+		q.FunctionRanges(rankFunction, indextank.AtMost(10), indextank.Between(25, 40))
+	})
+	expectDocids(t, results, "doc1", "doc3")
+}
+
+func testPaging(t *testing.T, idx indextank.Index) {
+	var docs []indextank.Document
+	var want []string
+	for i := 0; i < 7; i++ {
+		id := string(rune('a' + i))
+		docs = append(docs, doc(id, "conformance", float32(100-i), nil))
+		want = append(want, id)
+	}
+	addRanked(t, idx, docs...)
+
+	var got []string
+	for start := 0; start < len(docs); start += 3 {
+		results := search(t, idx, "conformance", func(q indextank.Query) {
+			q.Start(start)
+			q.NumResults(3)
+		})
+		if results.GetMatches() != int64(len(docs)) {
+			t.Errorf("page at %d: got %d matches, want %d", start, results.GetMatches(), len(docs))
+		}
+		if n := len(results.GetHits()); n > 3 {
+			t.Errorf("page at %d: got %d results, want at most 3", start, n)
+		}
+		got = append(got, docids(results)...)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pages hold documents %v, want %v", got, want)
+	}
+}
+
+func testFunctions(t *testing.T, idx indextank.Index) {
+	if err := idx.AddFunction(3, "-doc.var[0]"); err != nil {
+		t.Fatalf("AddFunction: %v", err)
+	}
+	functions, err := idx.ListFunctions()
+	if err != nil {
+		t.Fatalf("ListFunctions: %v", err)
+	}
+	if functions["3"] != "-doc.var[0]" {
+		t.Errorf("ListFunctions() = %v, want function 3 to be -doc.var[0]", functions)
+	}
+
+	addRanked(t, idx, doc("doc1", "conformance", 2, nil), doc("doc2", "conformance", 1, nil))
+	results, err := idx.SearchWithQuery(indextank.QueryForString("conformance").ScoringFunction(3))
+	if err != nil {
+		t.Fatalf("SearchWithQuery: %v", err)
+	}
+	expectDocids(t, results, "doc2", "doc1")
+	if hits := results.GetHits(); len(hits) == 2 && hits[0].Score != -1 {
+		t.Errorf("score of doc2 = %v, want -1", hits[0].Score)
+	}
+
+	if err := idx.DeleteFunction(3); err != nil {
+		t.Fatalf("DeleteFunction: %v", err)
+	}
+	functions, err = idx.ListFunctions()
+	if err != nil {
+		t.Fatalf("ListFunctions: %v", err)
+	}
+	if _, ok := functions["3"]; ok {
+		t.Errorf("ListFunctions() = %v after DeleteFunction(3)", functions)
+	}
+	if err := idx.AddFunction(4, "doc.var[0"); err == nil {
+		t.Error("AddFunction accepted an invalid definition")
+	}
+}
+
+func testInvalidQuery(t *testing.T, idx indextank.Index) {
+	addRanked(t, idx, doc("doc1", "conformance", 1, nil))
+	_, err := idx.Search("conformance AND")
+	if !errors.Is(err, indextank.ErrInvalidQuery) {
+		t.Errorf("Search of an invalid query: got error %v, want ErrInvalidQuery", err)
+	}
+}
+
+func testCanceledContext(t *testing.T, idx indextank.Index) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := idx.SearchContext(ctx, "conformance"); !errors.Is(err, context.Canceled) {
+		t.Errorf("SearchContext with a canceled context: got error %v, want context.Canceled", err)
+	}
+	err := idx.AddDocumentContext(ctx, "doc1", map[string]string{"text": "conformance"}, nil, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("AddDocumentContext with a canceled context: got error %v, want context.Canceled", err)
+	}
+	results, err := idx.Search("conformance")
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if ids := docids(results); len(ids) != 0 {
+		t.Errorf("documents %v were added with a canceled context", ids)
+	}
+}
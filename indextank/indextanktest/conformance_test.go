@@ -0,0 +1,19 @@
+package indextanktest
+
+import (
+	"testing"
+
+	"github.com/searchify/gotank/indextank"
+)
+
+func TestServerConformance(t *testing.T) {
+	RunIndexConformance(t, func(t *testing.T) indextank.Index {
+		srv := NewServer()
+		t.Cleanup(srv.Close)
+		idx, err := srv.ApiClient().CreateIndex("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return idx
+	})
+}
@@ -0,0 +1,108 @@
+package indextanktest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// handle passes a request to the handler, making the documents in failDocids fail.
+func (s *Server) handle(w http.ResponseWriter, r *http.Request, body []byte, failDocids map[string]string) {
+	if len(failDocids) == 0 || r.Method == "GET" {
+		s.handler.ServeHTTP(w, withBody(r, body))
+		return
+	}
+	if !isBatch(body) {
+		var doc struct {
+			Docid string `json:"docid"`
+		}
+		if json.Unmarshal(body, &doc) != nil || doc.Docid == "" {
+			doc.Docid = r.URL.Query().Get("docid")
+		}
+		if msg, ok := failDocids[doc.Docid]; ok && doc.Docid != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		s.handler.ServeHTTP(w, withBody(r, body))
+		return
+	}
+
+	// send the handler the other documents, then add the failed ones to its results
+	key := resultKey(r)
+	var items []json.RawMessage
+	if key == "" || json.Unmarshal(body, &items) != nil {
+		s.handler.ServeHTTP(w, withBody(r, body))
+		return
+	}
+	kept := make([]json.RawMessage, 0, len(items))
+	failed := map[int]string{}
+	for i, item := range items {
+		var doc struct {
+			Docid string `json:"docid"`
+		}
+		json.Unmarshal(item, &doc)
+		if msg, ok := failDocids[doc.Docid]; ok {
+			failed[i] = msg
+		} else {
+			kept = append(kept, item)
+		}
+	}
+	keptBody, _ := json.Marshal(kept)
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, withBody(r, keptBody))
+
+	var results []json.RawMessage
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &results) != nil || len(results) != len(kept) {
+		copyResponse(w, rec)
+		return
+	}
+	merged := make([]interface{}, len(items))
+	for i, j := 0, 0; i < len(items); i++ {
+		if msg, ok := failed[i]; ok {
+			merged[i] = map[string]interface{}{key: false, "error": msg}
+		} else {
+			merged[i] = results[j]
+			j++
+		}
+	}
+	data, _ := json.Marshal(merged)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// resultKey returns the key of the results of a batch call, e.g. "added" in {"added":true}.
+func resultKey(r *http.Request) string {
+	switch {
+	case r.Method == "PUT" && strings.HasSuffix(r.URL.Path, "/docs"):
+		return "added"
+	case r.Method == "DELETE" && strings.HasSuffix(r.URL.Path, "/docs"):
+		return "deleted"
+	case r.Method == "PUT" && strings.HasSuffix(r.URL.Path, "/docs/categories"):
+		return "updated"
+	}
+	return ""
+}
+
+// isBatch returns whether a JSON request body holds a list.
+func isBatch(body []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(body), []byte("["))
+}
+
+// withBody returns a copy of r with the given body.
+func withBody(r *http.Request, body []byte) *http.Request {
+	r2 := r.Clone(r.Context())
+	r2.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r2.ContentLength = int64(len(body))
+	return r2
+}
+
+func copyResponse(w http.ResponseWriter, rec *httptest.ResponseRecorder) {
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.Code)
+	w.Write(rec.Body.Bytes())
+}
@@ -0,0 +1,225 @@
+// Package indextanktest provides a fake IndexTank server for testing code that uses the
+// indextank package over HTTP.
+//
+// A Server implements the /v1/indexes endpoints used by indextank.ApiClient and indextank.Index
+// with the handler of package server, which keeps each index in an indextank.MemoryIndex.
+// Tests can script failures with rules and inspect the requests the client sent:
+//
+//	srv := indextanktest.NewServer()
+//	defer srv.Close()
+//	srv.Script(indextanktest.Rule{Method: "PUT", Path: "/docs", Status: 503, Times: 1})
+//	client := srv.ApiClient()
+//	idx, _ := client.CreateIndex("test")
+//	err := idx.AddDocument("doc1", map[string]string{"text": "hello"}, nil, nil) // 503
+//	req, _ := srv.LastRequest()
+package indextanktest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/searchify/gotank/indextank"
+	"github.com/searchify/gotank/indextank/server"
+)
+
+// Rule scripts the response to the requests matching its Method and Path. Rules are tried in the
+// order they were added, and the first one that matches a request and hasn't been used up applies.
+type Rule struct {
+	// HTTP method to match, or "" for any method
+	Method string
+	// Suffix of the URL path to match, e.g. "/search", "/docs" or "/v1/indexes/test", or "" for any path
+	Path string
+	// Number of requests the rule applies to, or 0 for all of them
+	Times int
+
+	// Time to wait before responding, or before handling the request normally
+	Delay time.Duration
+	// Status code to respond with, along with Header and Body, instead of handling the request.
+	// If 0, the request is handled normally, after Delay, FailDocids and MalformedJSON apply.
+	Status int
+	Header http.Header
+	Body   string
+	// Handle the request normally, but send only the first half of the response body
+	MalformedJSON bool
+	// Document ids, with their error messages, that fail in batch calls (AddDocuments, DeleteDocuments
+	// and UpdateCategoriesBatch) without being applied. Single document calls for them fail with a 400.
+	FailDocids map[string]string
+}
+
+// Request is a request received by a Server.
+type Request struct {
+	Method string
+	// URL path, e.g. /v1/indexes/test/docs
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// DecodeJSON unmarshals the body of the request into v.
+func (r Request) DecodeJSON(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// Server is a fake IndexTank server running on a local address. Its indexes are empty
+// until the client, or the test through CreateIndex, creates them.
+type Server struct {
+	*httptest.Server
+
+	handler  *server.Server
+	mu       sync.Mutex
+	rules    []*scriptedRule
+	requests []Request
+}
+
+type scriptedRule struct {
+	Rule
+	used int
+}
+
+// NewServer starts and returns a new Server. The caller should call Close when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{handler: server.New()}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// ApiClient returns an ApiClient for the server, configured with options.
+func (s *Server) ApiClient(options ...indextank.ClientOption) indextank.ApiClient {
+	client, err := indextank.NewApiClientWithOptions(s.URL, options...)
+	if err != nil {
+		panic("indextanktest: " + err.Error())
+	}
+	return client
+}
+
+// CreateIndex creates an index directly on the server, or returns the existing one, so tests
+// can seed data without going through the client.
+func (s *Server) CreateIndex(name string) *indextank.MemoryIndex {
+	// can't fail, the handler keeps indexes in memory only
+	idx, _ := s.handler.CreateIndex(name)
+	return idx
+}
+
+// Index returns the data of an index, or nil if it does not exist.
+func (s *Server) Index(name string) *indextank.MemoryIndex {
+	return s.handler.Index(name)
+}
+
+// Script adds rules, after the ones already added.
+func (s *Server) Script(rules ...Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range rules {
+		s.rules = append(s.rules, &scriptedRule{Rule: r})
+	}
+}
+
+// ResetRules removes all rules, so that every request is handled normally.
+func (s *Server) ResetRules() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = nil
+}
+
+// Requests returns the requests received so far, in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// LastRequest returns the last request received, if any.
+func (s *Server) LastRequest() (Request, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requests) == 0 {
+		return Request{}, false
+	}
+	return s.requests[len(s.requests)-1], true
+}
+
+// ClearRequests forgets the requests received so far.
+func (s *Server) ClearRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rule := s.record(r, body)
+	if rule == nil {
+		s.handle(w, r, body, nil)
+		return
+	}
+
+	if rule.Delay > 0 {
+		t := time.NewTimer(rule.Delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	for k, v := range rule.Header {
+		w.Header()[k] = v
+	}
+	if rule.Status != 0 {
+		w.WriteHeader(rule.Status)
+		io.WriteString(w, rule.Body)
+		return
+	}
+	if !rule.MalformedJSON {
+		s.handle(w, r, body, rule.FailDocids)
+		return
+	}
+	rec := httptest.NewRecorder()
+	s.handle(rec, r, body, rule.FailDocids)
+	b := rec.Body.Bytes()
+	if len(b) < 2 {
+		b = []byte("{}")
+	}
+	rec.Body = bytes.NewBuffer(b[:len(b)/2])
+	copyResponse(w, rec)
+}
+
+// record saves a request and returns the rule that applies to it, if any.
+func (s *Server) record(r *http.Request, body []byte) *Rule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   body,
+	})
+	for _, rule := range s.rules {
+		if rule.Times > 0 && rule.used >= rule.Times {
+			continue
+		}
+		if rule.Method != "" && rule.Method != r.Method {
+			continue
+		}
+		if !strings.HasSuffix(r.URL.Path, rule.Path) {
+			continue
+		}
+		rule.used++
+		return &rule.Rule
+	}
+	return nil
+}
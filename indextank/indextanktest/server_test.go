@@ -0,0 +1,174 @@
+package indextanktest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/searchify/gotank/indextank"
+)
+
+// newTestIndex returns a server with an empty index "test", and a client Index for it.
+func newTestIndex(t *testing.T) (*Server, indextank.Index) {
+	t.Helper()
+	srv := NewServer()
+	t.Cleanup(srv.Close)
+	srv.CreateIndex("test")
+	return srv, srv.ApiClient().GetIndex("test")
+}
+
+func addHello(idx indextank.Index, docid string) error {
+	return idx.AddDocument(docid, map[string]string{"text": "hello"}, nil, nil)
+}
+
+func TestRuleStatus(t *testing.T) {
+	srv, idx := newTestIndex(t)
+	srv.Script(Rule{Method: "PUT", Path: "/docs", Status: 503, Body: "busy", Header: http.Header{"Retry-After": {"1"}}, Times: 1})
+
+	err := addHello(idx, "doc1")
+	var apiErr *indextank.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 503 || apiErr.Body != "busy" {
+		t.Fatalf("AddDocument = %v, want the scripted 503", err)
+	}
+	if srv.Index("test").GetSize() != 0 {
+		t.Error("the scripted request was applied")
+	}
+	// the rule is used up
+	if err := addHello(idx, "doc1"); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Index("test").GetSize() != 1 {
+		t.Error("the request after the rule was not applied")
+	}
+
+	// rules only match their method and path
+	srv.Script(Rule{Method: "DELETE", Status: 500}, Rule{Path: "/search", Status: 400})
+	if _, err := idx.GetMetadata(); err != nil {
+		t.Errorf("GetMetadata = %v, want no rule to apply", err)
+	}
+	if _, err := idx.Search("hello"); !errors.Is(err, indextank.ErrInvalidQuery) {
+		t.Errorf("Search = %v, want the scripted 400", err)
+	}
+	srv.ResetRules()
+	if _, err := idx.Search("hello"); err != nil {
+		t.Errorf("Search after ResetRules = %v", err)
+	}
+}
+
+func TestRuleDelay(t *testing.T) {
+	srv, idx := newTestIndex(t)
+	srv.Script(Rule{Path: "/search", Delay: 50 * time.Millisecond})
+
+	start := time.Now()
+	if _, err := idx.Search("hello"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Search returned after %v, want a 50ms delay", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := idx.SearchContext(ctx, "hello"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SearchContext = %v, want a deadline error", err)
+	}
+}
+
+func TestRuleMalformedJSON(t *testing.T) {
+	srv, idx := newTestIndex(t)
+	if err := addHello(idx, "doc1"); err != nil {
+		t.Fatal(err)
+	}
+	srv.Script(Rule{Path: "/search", MalformedJSON: true, Times: 1})
+	if _, err := idx.Search("hello"); err == nil {
+		t.Error("Search accepted a truncated response")
+	}
+	if _, err := idx.Search("hello"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRuleFailDocids(t *testing.T) {
+	srv, idx := newTestIndex(t)
+	srv.Script(Rule{FailDocids: map[string]string{"b": "b is broken"}})
+
+	docs := []indextank.Document{
+		{Id: "a", Fields: map[string]string{"text": "hello"}},
+		{Id: "b", Fields: map[string]string{"text": "hello"}},
+		{Id: "c", Fields: map[string]string{"text": "hello"}},
+	}
+	results, err := idx.AddDocuments(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := results.GetFailedDocuments()
+	if msg, _ := results.GetErrorMessage(1); len(failed) != 1 || failed[0].Id != "b" || msg != "b is broken" {
+		t.Errorf("failed documents %v, message %q, want b", failed, msg)
+	}
+	if srv.Index("test").GetSize() != 2 {
+		t.Errorf("index has %d documents, want a and c", srv.Index("test").GetSize())
+	}
+
+	if err := addHello(idx, "b"); err == nil {
+		t.Error("AddDocument succeeded for a failing docid")
+	}
+	deleted, err := idx.DeleteDocuments([]string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(deleted.GetFailedDocids(), []string{"b"}) {
+		t.Errorf("failed deletes %v, want [b]", deleted.GetFailedDocids())
+	}
+	updated, err := idx.UpdateCategoriesBatch([]indextank.CategoryUpdate{{Id: "b"}, {Id: "c", Categories: map[string]string{"x": "y"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(updated.GetFailedDocids(), []string{"b"}) {
+		t.Errorf("failed updates %v, want [b]", updated.GetFailedDocids())
+	}
+}
+
+func TestRequests(t *testing.T) {
+	srv, idx := newTestIndex(t)
+	if _, ok := srv.LastRequest(); ok {
+		t.Error("LastRequest reported a request before any was sent")
+	}
+	if err := addHello(idx, "doc1"); err != nil {
+		t.Fatal(err)
+	}
+	query := indextank.QueryForString("hello")
+	query.FetchFields("text")
+	if _, err := idx.SearchWithQuery(query); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := srv.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("%d requests recorded, want 2", len(requests))
+	}
+	var doc struct {
+		Docid  string            `json:"docid"`
+		Fields map[string]string `json:"fields"`
+	}
+	if err := requests[0].DecodeJSON(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if requests[0].Method != "PUT" || requests[0].Path != "/v1/indexes/test/docs" || doc.Docid != "doc1" || doc.Fields["text"] != "hello" {
+		t.Errorf("request 0 = %s %s %s", requests[0].Method, requests[0].Path, requests[0].Body)
+	}
+	last, ok := srv.LastRequest()
+	if !ok || last.Method != "GET" || last.Path != "/v1/indexes/test/search" || last.Query.Get("q") != "hello" || last.Query.Get("fetch") != "text" {
+		t.Errorf("last request = %s %s?%s", last.Method, last.Path, last.Query.Encode())
+	}
+	if last.Header.Get("User-Agent") == "" {
+		t.Error("request headers were not recorded")
+	}
+
+	srv.ClearRequests()
+	if len(srv.Requests()) != 0 {
+		t.Error("ClearRequests kept requests")
+	}
+}
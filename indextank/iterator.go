@@ -0,0 +1,240 @@
+package indextank
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"hash/fnv"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const defaultIteratorPageSize = 100
+
+// ErrInvalidCursor is returned by a HitIterator resumed from a cursor that is malformed
+// or that was taken from an iterator over a different query.
+var ErrInvalidCursor = errors.New("Invalid search cursor")
+
+// HitIteratorOptions configures a HitIterator.
+type HitIteratorOptions struct {
+	// Number of results fetched per request. Defaults to 100.
+	PageSize int
+	// Whether to fetch the next page in the background while the current one is consumed.
+	Prefetch bool
+	// Cursor, as returned by HitIterator.Cursor, to resume a previous iteration from, instead of
+	// beginning at the query's Start.
+	Cursor string
+}
+
+// HitIterator walks all the hits of a query, fetching successive pages with Index.SearchWithQueryContext
+// until SearchResults.GetMatches() hits have been returned. Use it like:
+//
+//	it := indextank.NewHitIterator(ctx, idx, query, indextank.HitIteratorOptions{})
+//	defer it.Close()
+//	for it.Next() {
+//		hit := it.Hit()
+//		...
+//	}
+//	if err := it.Err(); err != nil { ... }
+//
+// The iteration begins at the query's Start, 0 unless set. The iterator sets Start and NumResults on
+// a clone of the query for every page, so the query passed in is left unchanged and may be frozen. A HitIterator is not safe for use by multiple goroutines.
+type HitIterator interface {
+	// Next advances to the next hit, returning false when there are no more hits or an error occurred.
+	Next() bool
+	// Hit returns the current hit.
+	Hit() Hit
+	// Err returns the error that stopped the iteration, if any.
+	Err() error
+	// Matches returns the total number of matches reported by the last page fetched.
+	Matches() int64
+	// Cursor returns an opaque token for the position after the current hit. Pass it in
+	// HitIteratorOptions.Cursor, with the same query, to resume the iteration from there.
+	Cursor() string
+	// Close stops any background fetch. It does not need to be called after Next returned false.
+	Close()
+}
+
+type page struct {
+	results SearchResults
+	err     error
+}
+
+type hitIterator struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
+	index       Index
+	query       Query
+	pageSize    int
+	prefetch    bool
+	fingerprint string
+
+	offset    int // offset of the next page to fetch
+	pageStart int // offset of hits[0]
+	hits      []Hit
+	pos       int
+	matches   int64
+	fetched   bool
+	done      bool
+	err       error
+	next      chan page // pending prefetch, if any
+}
+
+// NewHitIterator returns a HitIterator over the hits of query in index.
+func NewHitIterator(ctx context.Context, index Index, query Query, options HitIteratorOptions) HitIterator {
+	ctx, cancel := context.WithCancel(ctx)
+	it := &hitIterator{
+		ctx:         ctx,
+		cancel:      cancel,
+		index:       index,
+		query:       query,
+		pageSize:    options.PageSize,
+		prefetch:    options.Prefetch,
+		fingerprint: queryFingerprint(query),
+		pos:         -1,
+	}
+	if it.pageSize <= 0 {
+		it.pageSize = defaultIteratorPageSize
+	}
+	it.offset = queryStart(query)
+	it.pageStart = it.offset
+
+	if options.Cursor != "" {
+		offset, err := it.decodeCursor(options.Cursor)
+		if err != nil {
+			it.err = err
+		}
+		it.offset = offset
+		it.pageStart = offset
+	}
+	return it
+}
+
+func (it *hitIterator) Next() bool {
+	if it.err != nil || it.done {
+		return false
+	}
+	it.pos++
+	if it.pos < len(it.hits) {
+		return true
+	}
+	if it.fetched && (len(it.hits) < it.pageSize || int64(it.offset) >= it.matches) {
+		it.finish()
+		return false
+	}
+
+	var p page
+	if it.next != nil {
+		p = <-it.next
+		it.next = nil
+	} else {
+		p = it.fetch(it.offset)
+	}
+	if p.err != nil {
+		it.err = p.err
+		it.finish()
+		return false
+	}
+
+	it.fetched = true
+	it.hits = p.results.GetHits()
+	it.matches = p.results.GetMatches()
+	it.pageStart = it.offset
+	it.offset += len(it.hits)
+	it.pos = 0
+	if len(it.hits) == 0 {
+		it.finish()
+		return false
+	}
+	if it.prefetch && len(it.hits) == it.pageSize && int64(it.offset) < it.matches {
+		next := make(chan page, 1)
+		go func(offset int) {
+			next <- it.fetch(offset)
+		}(it.offset)
+		it.next = next
+	}
+	return true
+}
+
+func (it *hitIterator) fetch(offset int) page {
+	results, err := it.index.SearchWithQueryContext(it.ctx, pageQuery(it.query, offset, it.pageSize))
+	return page{results, err}
+}
+
+func (it *hitIterator) finish() {
+	it.done = true
+	it.Close()
+}
+
+func (it *hitIterator) Hit() Hit {
+	if it.pos < 0 || it.pos >= len(it.hits) {
+		return Hit{}
+	}
+	return it.hits[it.pos]
+}
+
+func (it *hitIterator) Err() error {
+	return it.err
+}
+
+func (it *hitIterator) Matches() int64 {
+	return it.matches
+}
+
+func (it *hitIterator) Cursor() string {
+	offset := it.pageStart
+	if it.pos >= 0 {
+		offset += it.pos + 1
+		if it.pos >= len(it.hits) {
+			offset = it.pageStart + len(it.hits)
+		}
+	}
+	s := strconv.Itoa(offset) + ":" + it.fingerprint
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func (it *hitIterator) Close() {
+	it.cancel()
+}
+
+func (it *hitIterator) decodeCursor(cursor string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(b), ":", 2)
+	if len(parts) != 2 || parts[1] != it.fingerprint {
+		return 0, ErrInvalidCursor
+	}
+	offset, err := strconv.Atoi(parts[0])
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return offset, nil
+}
+
+// queryFingerprint identifies a query regardless of its paging parameters.
+func queryFingerprint(query Query) string {
+	params, _ := url.ParseQuery(query.ToQueryParams())
+	params.Del("start")
+	params.Del("len")
+	h := fnv.New64a()
+	h.Write([]byte(params.Encode()))
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
+// queryStart returns the offset of the first result a query asks for.
+func queryStart(query Query) int {
+	params, _ := url.ParseQuery(query.ToQueryParams())
+	start, _ := strconv.Atoi(params.Get("start"))
+	return start
+}
+
+// pageQuery returns a copy of query set to fetch length results from start.
+func pageQuery(query Query, start, length int) Query {
+	query = query.Clone()
+	query.Start(start)
+	query.NumResults(length)
+	return query
+}
@@ -0,0 +1,142 @@
+package indextank
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// newIteratorIndex returns a MemoryIndex with n documents matching "hello", ranked doc0 first.
+func newIteratorIndex(t *testing.T, n int) *MemoryIndex {
+	t.Helper()
+	idx := NewMemoryIndex()
+	if err := idx.AddFunction(1, "doc.var[0]"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		err := idx.AddDocument(fmt.Sprintf("doc%d", i), map[string]string{"text": "hello"}, map[int]float32{0: float32(n - i)}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return idx
+}
+
+func iteratorQuery() Query {
+	q := QueryForString("hello")
+	q.ScoringFunction(1)
+	return q
+}
+
+// collect returns the docids of the remaining hits of it.
+func collect(t *testing.T, it HitIterator) []string {
+	t.Helper()
+	var docids []string
+	for it.Next() {
+		docids = append(docids, it.Hit().Docid)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return docids
+}
+
+func TestHitIteratorFrozenQuery(t *testing.T) {
+	idx := newIteratorIndex(t, 5)
+	want := []string{"doc0", "doc1", "doc2", "doc3", "doc4"}
+	for _, prefetch := range []bool{false, true} {
+		query := iteratorQuery().Freeze()
+		before := query.ToQueryParams()
+		it := NewHitIterator(context.Background(), idx, query, HitIteratorOptions{PageSize: 2, Prefetch: prefetch})
+		got := collect(t, it)
+		it.Close()
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("prefetch %v: got %v, want %v", prefetch, got, want)
+		}
+		if after := query.ToQueryParams(); after != before {
+			t.Errorf("prefetch %v: query changed from %s to %s", prefetch, before, after)
+		}
+	}
+}
+
+func TestHitIteratorCursor(t *testing.T) {
+	idx := newIteratorIndex(t, 5)
+	all := []string{"doc0", "doc1", "doc2", "doc3", "doc4"}
+	for stop := 0; stop <= len(all); stop++ {
+		for _, prefetch := range []bool{false, true} {
+			options := HitIteratorOptions{PageSize: 2, Prefetch: prefetch}
+			it := NewHitIterator(context.Background(), idx, iteratorQuery(), options)
+			var got []string
+			for len(got) < stop && it.Next() {
+				got = append(got, it.Hit().Docid)
+			}
+			cursor := it.Cursor()
+			it.Close()
+
+			options.Cursor = cursor
+			resumed := NewHitIterator(context.Background(), idx, iteratorQuery(), options)
+			got = append(got, collect(t, resumed)...)
+			resumed.Close()
+			if !reflect.DeepEqual(got, all) {
+				t.Errorf("stop %d, prefetch %v: got %v, want %v", stop, prefetch, got, all)
+			}
+		}
+	}
+}
+
+func TestHitIteratorInvalidCursor(t *testing.T) {
+	idx := newIteratorIndex(t, 3)
+	it := NewHitIterator(context.Background(), idx, iteratorQuery(), HitIteratorOptions{PageSize: 2})
+	it.Next()
+	cursor := it.Cursor()
+	it.Close()
+
+	other := iteratorQuery()
+	other.FetchFields("text")
+	tests := []struct {
+		query  Query
+		cursor string
+	}{
+		{other, cursor},
+		{QueryForString("goodbye"), cursor},
+		{iteratorQuery(), "not a cursor!"},
+		{iteratorQuery(), base64.RawURLEncoding.EncodeToString([]byte("12"))},
+		{iteratorQuery(), base64.RawURLEncoding.EncodeToString([]byte("-1:" + queryFingerprint(iteratorQuery())))},
+		{iteratorQuery(), base64.RawURLEncoding.EncodeToString([]byte("x:" + queryFingerprint(iteratorQuery())))},
+	}
+	for _, test := range tests {
+		it := NewHitIterator(context.Background(), idx, test.query, HitIteratorOptions{Cursor: test.cursor})
+		if it.Next() {
+			t.Errorf("cursor %q: iterator returned %s", test.cursor, it.Hit().Docid)
+		}
+		if err := it.Err(); err != ErrInvalidCursor {
+			t.Errorf("cursor %q: Err() = %v, want ErrInvalidCursor", test.cursor, err)
+		}
+		it.Close()
+	}
+}
+
+func TestHitIteratorQueryStart(t *testing.T) {
+	idx := newIteratorIndex(t, 5)
+	for _, prefetch := range []bool{false, true} {
+		query := iteratorQuery()
+		query.Start(2)
+		options := HitIteratorOptions{PageSize: 2, Prefetch: prefetch}
+		it := NewHitIterator(context.Background(), idx, query, options)
+		if !it.Next() || it.Hit().Docid != "doc2" {
+			t.Fatalf("prefetch %v: iteration doesn't begin at doc2", prefetch)
+		}
+		options.Cursor = it.Cursor()
+		it.Close()
+
+		// a cursor overrides Start
+		it = NewHitIterator(context.Background(), idx, query, options)
+		got := collect(t, it)
+		it.Close()
+		if want := []string{"doc3", "doc4"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("prefetch %v: resumed iteration got %v, want %v", prefetch, got, want)
+		}
+	}
+}
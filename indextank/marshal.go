@@ -0,0 +1,236 @@
+package indextank
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// MarshalDocument converts a struct, or a pointer to one, to a Document, using the indextank tags
+// of its fields:
+//
+//	type Product struct {
+//		SKU     string    `indextank:"docid"`
+//		Name    string    `indextank:"field=text"`
+//		Tags    []string  `indextank:"field=tags,omitempty"`
+//		Price   float64   `indextank:"var=0"`
+//		Color   string    `indextank:"category=color,omitempty"`
+//		Updated time.Time `indextank:"timestamp"`
+//		Notes   string    // not indexed
+//	}
+//
+//	doc, err := indextank.MarshalDocument(product)
+//
+// The docid is required. Fields and categories take strings, numbers, booleans, times (formatted as
+// RFC 3339), durations (formatted like "1.5s") and types implementing encoding.TextMarshaler; fields
+// also take slices of those, joined with spaces. Variables take numbers, booleans (0 or 1), times (seconds since the epoch, with the
+// precision of a float32) and durations (seconds). The timestamp, used to compute the age of a
+// document in scoring functions, takes a time or a number of seconds since the epoch.
+//
+// Nil pointers are left out, as are zero values with the omitempty option. Fields of embedded
+// structs without a tag are mapped as if they were fields of the outer struct. The snippet and
+// score tags, used by SearchResults.Decode, are ignored.
+func MarshalDocument(v interface{}) (Document, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return Document{}, errors.New("Can't marshal a nil pointer to a Document")
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return Document{}, fmt.Errorf("Can't marshal %T to a Document, it is not a struct", v)
+	}
+	m, err := mappingOf(rv.Type())
+	if err != nil {
+		return Document{}, err
+	}
+
+	doc := Document{Fields: map[string]string{}, Variables: map[string]float32{}, Categories: map[string]string{}}
+	for _, fm := range m.fields {
+		f, ok := fieldByIndex(rv, fm.index)
+		if !ok || isNil(f) || fm.omitEmpty && isEmpty(f) {
+			continue
+		}
+		if err := fm.marshal(&doc, f); err != nil {
+			return Document{}, fmt.Errorf("Can't marshal %s: %v", fm.goName, err)
+		}
+	}
+	if doc.Id == "" {
+		return Document{}, fmt.Errorf("%s has no docid: tag a non-empty field with `indextank:\"docid\"`", rv.Type())
+	}
+	return doc, nil
+}
+
+// MarshalDocuments converts a slice or array of structs, or of pointers to structs, to Documents
+// with MarshalDocument, e.g. for Index.AddDocuments.
+func MarshalDocuments(v interface{}) ([]Document, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("Can't marshal %T to Documents, it is not a slice", v)
+	}
+	docs := make([]Document, rv.Len())
+	for i := range docs {
+		doc, err := MarshalDocument(rv.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("Element %d: %v", i, err)
+		}
+		docs[i] = doc
+	}
+	return docs, nil
+}
+
+// NumberedVariables returns the variables of a document keyed by number, e.g. for Index.AddDocument:
+//
+//	err := idx.AddDocument(doc.Id, doc.Fields, doc.NumberedVariables(), doc.Categories)
+func (doc Document) NumberedVariables() map[int]float32 {
+	vars := make(map[int]float32, len(doc.Variables))
+	for k, v := range doc.Variables {
+		if n, err := strconv.Atoi(k); err == nil {
+			vars[n] = v
+		}
+	}
+	return vars
+}
+
+func (fm fieldMapping) marshal(doc *Document, v reflect.Value) error {
+	switch fm.kind {
+	case tagDocid:
+		s, err := textOf(v, false)
+		if err != nil {
+			return err
+		}
+		doc.Id = s
+	case tagField:
+		s, err := textOf(v, true)
+		if err != nil {
+			return err
+		}
+		doc.Fields[fm.name] = s
+	case tagCategory:
+		s, err := textOf(v, false)
+		if err != nil {
+			return err
+		}
+		doc.Categories[fm.name] = s
+	case tagVar:
+		f, err := numberOf(v)
+		if err != nil {
+			return err
+		}
+		doc.Variables[strconv.Itoa(fm.num)] = float32(f)
+	case tagTimestamp:
+		v = indirect(v)
+		if v.Type() == timeType {
+			doc.Fields[timestampField] = strconv.FormatInt(v.Interface().(time.Time).Unix(), 10)
+			return nil
+		}
+		f, err := numberOf(v)
+		if err != nil {
+			return err
+		}
+		doc.Fields[timestampField] = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return nil
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
+func isNil(v reflect.Value) bool {
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String, reflect.Array:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// textOf converts a value to the text of a docid, field or category. Lists are only allowed in fields.
+func textOf(v reflect.Value, list bool) (string, error) {
+	v = indirect(v)
+	t := v.Type()
+	switch {
+	case t == timeType:
+		return v.Interface().(time.Time).Format(time.RFC3339), nil
+	case t == durationType:
+		return time.Duration(v.Int()).String(), nil
+	case t.Implements(textMarshalerType):
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64), nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return string(v.Bytes()), nil
+		}
+		if !list {
+			break
+		}
+		words := make([]string, v.Len())
+		for i := range words {
+			s, err := textOf(v.Index(i), false)
+			if err != nil {
+				return "", err
+			}
+			words[i] = s
+		}
+		return strings.Join(words, " "), nil
+	}
+	return "", fmt.Errorf("%s can't be converted to text", t)
+}
+
+// numberOf converts a value to the value of a variable.
+func numberOf(v reflect.Value) (float64, error) {
+	v = indirect(v)
+	t := v.Type()
+	switch {
+	case t == timeType:
+		return float64(v.Interface().(time.Time).Unix()), nil
+	case t == durationType:
+		return time.Duration(v.Int()).Seconds(), nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return 1, nil
+		}
+		return 0, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	}
+	return 0, fmt.Errorf("%s can't be converted to a number", t)
+}
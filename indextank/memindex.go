@@ -0,0 +1,996 @@
+package indextank
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// the field searched by query terms that aren't restricted to a field
+const defaultSearchField = "text"
+
+// the scoring function of a new index, which ranks newer documents first
+const defaultScoringFunction = "-age"
+
+// MemoryIndex is an Index kept in process memory, for unit tests and local development. It supports
+// the IndexTank query syntax (see ParseQueryExpr) over the "text" field and field-scoped clauses,
+// category filters and facets, document variable and function filters, scoring functions (see
+// ParseScoreFunction), fetched fields, variables and categories, and snippets.
+//
+// Relevance is a simple term frequency based score, so scores and the order of documents with
+// equal function values differ from those of a Searchify index. Snippets hold the whole field text,
+// HTML escaped, with the matched words in <b> tags. A MemoryIndex is safe for use by multiple goroutines.
+type MemoryIndex struct {
+	mu           sync.RWMutex
+	exists       bool
+	code         string
+	created      time.Time
+	publicSearch bool
+	docs         map[string]*memDoc
+	functions    map[int]string
+	parsed       map[int]ScoreExpr
+	now          func() time.Time
+}
+
+type memDoc struct {
+	doc       Document
+	vars      map[int]float64
+	tokens    map[string][]string // field -> lower cased words
+	timestamp float64
+}
+
+var memIndexCount int64
+var memIndexCountMu sync.Mutex
+
+// NewMemoryIndex returns a new, empty, started MemoryIndex with the default scoring function 0, "-age".
+func NewMemoryIndex() *MemoryIndex {
+	memIndexCountMu.Lock()
+	memIndexCount++
+	code := "mem" + strconv.FormatInt(memIndexCount, 36)
+	memIndexCountMu.Unlock()
+
+	idx := &MemoryIndex{code: code, now: time.Now}
+	idx.reset()
+	return idx
+}
+
+// reset makes the index an empty, existing index.
+func (idx *MemoryIndex) reset() {
+	idx.exists = true
+	idx.created = idx.now()
+	idx.publicSearch = false
+	idx.docs = make(map[string]*memDoc)
+	idx.functions = map[int]string{0: defaultScoringFunction}
+	f, _ := ParseScoreFunction(defaultScoringFunction)
+	idx.parsed = map[int]ScoreExpr{0: f}
+}
+
+// check returns the error for a call on this index, if any. Callers hold idx.mu.
+func (idx *MemoryIndex) check(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !idx.exists {
+		return ErrIndexNotFound
+	}
+	return nil
+}
+
+func (idx *MemoryIndex) Exists() bool {
+	return idx.ExistsContext(context.Background())
+}
+
+func (idx *MemoryIndex) ExistsContext(ctx context.Context) bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.exists
+}
+
+func (idx *MemoryIndex) HasStarted() bool {
+	return idx.HasStartedContext(context.Background())
+}
+
+func (idx *MemoryIndex) HasStartedContext(ctx context.Context) bool {
+	return idx.ExistsContext(ctx)
+}
+
+func (idx *MemoryIndex) Status() string {
+	if idx.Exists() {
+		return "LIVE"
+	}
+	return ""
+}
+
+func (idx *MemoryIndex) GetCode() string {
+	return idx.code
+}
+
+func (idx *MemoryIndex) GetSize() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if !idx.exists {
+		return -1
+	}
+	return len(idx.docs)
+}
+
+func (idx *MemoryIndex) GetCreationTime() *time.Time {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if !idx.exists {
+		return nil
+	}
+	// same precision as the creation_time metadata
+	t := idx.created.UTC().Truncate(time.Second)
+	return &t
+}
+
+func (idx *MemoryIndex) IsPublicSearchEnabled() bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.publicSearch
+}
+
+func (idx *MemoryIndex) GetMetadata() (map[string]interface{}, error) {
+	return idx.GetMetadataContext(context.Background())
+}
+
+func (idx *MemoryIndex) GetMetadataContext(ctx context.Context) (map[string]interface{}, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if err := idx.check(ctx); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"started":       true,
+		"status":        "LIVE",
+		"code":          idx.code,
+		"creation_time": idx.created.UTC().Format(iSO8601Format),
+		"size":          float64(len(idx.docs)),
+		"public_search": idx.publicSearch,
+	}, nil
+}
+
+func (idx *MemoryIndex) CreateIndex() error {
+	return idx.CreateIndexWithOptionsContext(context.Background(), nil)
+}
+
+func (idx *MemoryIndex) CreateIndexContext(ctx context.Context) error {
+	return idx.CreateIndexWithOptionsContext(ctx, nil)
+}
+
+func (idx *MemoryIndex) CreateIndexWithOptions(options map[string]interface{}) error {
+	return idx.CreateIndexWithOptionsContext(context.Background(), options)
+}
+
+func (idx *MemoryIndex) CreateIndexWithOptionsContext(ctx context.Context, options map[string]interface{}) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if idx.exists {
+		return ErrIndexAlreadyExists
+	}
+	idx.reset()
+	return idx.setOptions(options)
+}
+
+func (idx *MemoryIndex) UpdateIndex(options map[string]interface{}) error {
+	return idx.UpdateIndexContext(context.Background(), options)
+}
+
+func (idx *MemoryIndex) UpdateIndexContext(ctx context.Context, options map[string]interface{}) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.check(ctx); err != nil {
+		return err
+	}
+	return idx.setOptions(options)
+}
+
+func (idx *MemoryIndex) setOptions(options map[string]interface{}) error {
+	for k, v := range options {
+		if k != "public_search" {
+			return fmt.Errorf("Invalid index option %q", k)
+		}
+		b, ok := v.(bool)
+		if !ok {
+			return fmt.Errorf("Invalid value for index option %q: %v", k, v)
+		}
+		idx.publicSearch = b
+	}
+	return nil
+}
+
+func (idx *MemoryIndex) DeleteIndex() error {
+	return idx.DeleteIndexContext(context.Background())
+}
+
+func (idx *MemoryIndex) DeleteIndexContext(ctx context.Context) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.check(ctx); err != nil {
+		return err
+	}
+	idx.exists = false
+	idx.docs = nil
+	return nil
+}
+
+func (idx *MemoryIndex) AddDocument(docid string, fields map[string]string, variables map[int]float32, categories map[string]string) error {
+	return idx.AddDocumentContext(context.Background(), docid, fields, variables, categories)
+}
+
+func (idx *MemoryIndex) AddDocumentContext(ctx context.Context, docid string, fields map[string]string, variables map[int]float32, categories map[string]string) error {
+	doc, err := NewDocument(docid, fields, variables, categories)
+	if err != nil {
+		return err
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.check(ctx); err != nil {
+		return err
+	}
+	return idx.add(doc)
+}
+
+func (idx *MemoryIndex) AddDocuments(documents []Document) (BatchResults, error) {
+	return idx.AddDocumentsContext(context.Background(), documents)
+}
+
+func (idx *MemoryIndex) AddDocumentsContext(ctx context.Context, documents []Document) (BatchResults, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.check(ctx); err != nil {
+		return nil, err
+	}
+	r := make([]addResult, len(documents))
+	for i, doc := range documents {
+		if err := idx.add(doc); err != nil {
+			r[i] = addResult{Added: false, Error: err.Error()}
+		} else {
+			r[i] = addResult{Added: true}
+		}
+	}
+	return newBatchResults(documents, r), nil
+}
+
+// add adds or replaces a document. Callers hold idx.mu.
+func (idx *MemoryIndex) add(doc Document) error {
+	if doc.Id == "" {
+		return errors.New("Invalid or missing argument: docid")
+	}
+	if len(doc.Fields) == 0 {
+		return errors.New("Invalid or missing argument: fields")
+	}
+	if err := ValidateDocument(doc); err != nil {
+		return err
+	}
+	d := &memDoc{
+		doc:    copyDocument(doc),
+		vars:   map[int]float64{},
+		tokens: map[string][]string{},
+	}
+	for k, v := range doc.Variables {
+		n, err := strconv.Atoi(k)
+		if err != nil || n < 0 {
+			return fmt.Errorf("Invalid variable index %q", k)
+		}
+		d.vars[n] = float64(v)
+	}
+	for field, text := range doc.Fields {
+		d.tokens[field] = tokenize(text)
+	}
+	d.timestamp = float64(idx.now().Unix())
+	if ts, ok := doc.Fields["timestamp"]; ok {
+		t, err := strconv.ParseFloat(ts, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid timestamp %q", ts)
+		}
+		d.timestamp = t
+	}
+	idx.docs[doc.Id] = d
+	return nil
+}
+
+func copyDocument(doc Document) Document {
+	c := Document{Id: doc.Id, Fields: map[string]string{}, Variables: map[string]float32{}, Categories: map[string]string{}}
+	for k, v := range doc.Fields {
+		c.Fields[k] = v
+	}
+	for k, v := range doc.Variables {
+		c.Variables[k] = v
+	}
+	for k, v := range doc.Categories {
+		c.Categories[k] = v
+	}
+	return c
+}
+
+// MemoryIndexSnapshot holds the contents of a MemoryIndex, e.g. to save it to disk as JSON.
+type MemoryIndexSnapshot struct {
+	Code         string             `json:"code"`
+	CreationTime time.Time          `json:"creation_time"`
+	PublicSearch bool               `json:"public_search"`
+	Functions    map[int]string     `json:"functions"`
+	Documents    []SnapshotDocument `json:"documents"`
+}
+
+// SnapshotDocument is a document of a MemoryIndexSnapshot.
+type SnapshotDocument struct {
+	Document
+	// Time the document was added, or its "timestamp" field, in seconds since the epoch
+	Timestamp float64 `json:"timestamp"`
+}
+
+// Snapshot returns the contents of the index, with documents sorted by id.
+func (idx *MemoryIndex) Snapshot() (*MemoryIndexSnapshot, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if !idx.exists {
+		return nil, ErrIndexNotFound
+	}
+	s := &MemoryIndexSnapshot{
+		Code:         idx.code,
+		CreationTime: idx.created,
+		PublicSearch: idx.publicSearch,
+		Functions:    make(map[int]string, len(idx.functions)),
+		Documents:    make([]SnapshotDocument, 0, len(idx.docs)),
+	}
+	for k, v := range idx.functions {
+		s.Functions[k] = v
+	}
+	for _, d := range idx.docs {
+		s.Documents = append(s.Documents, SnapshotDocument{copyDocument(d.doc), d.timestamp})
+	}
+	sort.Slice(s.Documents, func(i, j int) bool {
+		return s.Documents[i].Id < s.Documents[j].Id
+	})
+	return s, nil
+}
+
+// RestoreMemoryIndex returns a MemoryIndex with the contents of a snapshot.
+func RestoreMemoryIndex(s *MemoryIndexSnapshot) (*MemoryIndex, error) {
+	idx := NewMemoryIndex()
+	if s.Code != "" {
+		idx.code = s.Code
+	}
+	idx.created = s.CreationTime
+	idx.publicSearch = s.PublicSearch
+	if s.Functions != nil {
+		idx.functions = map[int]string{}
+		idx.parsed = map[int]ScoreExpr{}
+	}
+	for k, v := range s.Functions {
+		f, err := ParseScoreFunction(v)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid function %d: %v", k, err)
+		}
+		idx.functions[k] = v
+		idx.parsed[k] = f
+	}
+	for _, d := range s.Documents {
+		if err := idx.add(d.Document); err != nil {
+			return nil, fmt.Errorf("Invalid document %q: %v", d.Id, err)
+		}
+		idx.docs[d.Id].timestamp = d.Timestamp
+	}
+	return idx, nil
+}
+
+func (idx *MemoryIndex) UpdateVariables(documentId string, variables map[int]float32) error {
+	return idx.UpdateVariablesContext(context.Background(), documentId, variables)
+}
+
+func (idx *MemoryIndex) UpdateVariablesContext(ctx context.Context, documentId string, variables map[int]float32) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.check(ctx); err != nil {
+		return err
+	}
+	d, ok := idx.docs[documentId]
+	if !ok {
+		return fmt.Errorf("Document %q does not exist", documentId)
+	}
+	for k := range variables {
+		if k < 0 {
+			return fmt.Errorf("Invalid variable index %d", k)
+		}
+	}
+	for k, v := range variables {
+		d.vars[k] = float64(v)
+		d.doc.Variables[strconv.Itoa(k)] = v
+	}
+	return nil
+}
+
+func (idx *MemoryIndex) UpdateCategories(documentId string, categories map[string]string) error {
+	return idx.UpdateCategoriesContext(context.Background(), documentId, categories)
+}
+
+func (idx *MemoryIndex) UpdateCategoriesContext(ctx context.Context, documentId string, categories map[string]string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.check(ctx); err != nil {
+		return err
+	}
+	return idx.updateCategories(documentId, categories)
+}
+
+// updateCategories sets categories of a document; an empty value removes a category. Callers hold idx.mu.
+func (idx *MemoryIndex) updateCategories(documentId string, categories map[string]string) error {
+	d, ok := idx.docs[documentId]
+	if !ok {
+		return fmt.Errorf("Document %q does not exist", documentId)
+	}
+	for k, v := range categories {
+		if v == "" {
+			delete(d.doc.Categories, k)
+		} else {
+			d.doc.Categories[k] = v
+		}
+	}
+	return nil
+}
+
+func (idx *MemoryIndex) UpdateCategoriesBatch(updates []CategoryUpdate) (BulkUpdateResults, error) {
+	return idx.UpdateCategoriesBatchContext(context.Background(), updates)
+}
+
+func (idx *MemoryIndex) UpdateCategoriesBatchContext(ctx context.Context, updates []CategoryUpdate) (BulkUpdateResults, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.check(ctx); err != nil {
+		return nil, err
+	}
+	documentIds := make([]string, len(updates))
+	r := make([]updateResult, len(updates))
+	for i, u := range updates {
+		documentIds[i] = u.Id
+		if err := idx.updateCategories(u.Id, u.Categories); err != nil {
+			r[i] = updateResult{Updated: false, Error: err.Error()}
+		} else {
+			r[i] = updateResult{Updated: true}
+		}
+	}
+	return newUpdateResults(documentIds, r), nil
+}
+
+func (idx *MemoryIndex) DeleteDocument(documentId string) error {
+	return idx.DeleteDocumentContext(context.Background(), documentId)
+}
+
+func (idx *MemoryIndex) DeleteDocumentContext(ctx context.Context, documentId string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.check(ctx); err != nil {
+		return err
+	}
+	delete(idx.docs, documentId)
+	return nil
+}
+
+func (idx *MemoryIndex) DeleteDocuments(documentIds []string) (BulkDeleteResults, error) {
+	return idx.DeleteDocumentsContext(context.Background(), documentIds)
+}
+
+func (idx *MemoryIndex) DeleteDocumentsContext(ctx context.Context, documentIds []string) (BulkDeleteResults, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.check(ctx); err != nil {
+		return nil, err
+	}
+	r := make([]deleteResult, len(documentIds))
+	for i, docid := range documentIds {
+		if docid == "" {
+			r[i] = deleteResult{Deleted: false, Error: "Invalid or missing argument: docid"}
+			continue
+		}
+		delete(idx.docs, docid)
+		r[i] = deleteResult{Deleted: true}
+	}
+	return newBulkResults(documentIds, r), nil
+}
+
+func (idx *MemoryIndex) AddFunction(functionIndex int, definition string) error {
+	return idx.AddFunctionContext(context.Background(), functionIndex, definition)
+}
+
+func (idx *MemoryIndex) AddFunctionContext(ctx context.Context, functionIndex int, definition string) error {
+	if functionIndex < 0 {
+		return fmt.Errorf("Invalid function index %d", functionIndex)
+	}
+	f, err := ParseScoreFunction(definition)
+	if err != nil {
+		return err
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.check(ctx); err != nil {
+		return err
+	}
+	idx.functions[functionIndex] = definition
+	idx.parsed[functionIndex] = f
+	return nil
+}
+
+func (idx *MemoryIndex) DeleteFunction(functionIndex int) error {
+	return idx.DeleteFunctionContext(context.Background(), functionIndex)
+}
+
+func (idx *MemoryIndex) DeleteFunctionContext(ctx context.Context, functionIndex int) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.check(ctx); err != nil {
+		return err
+	}
+	delete(idx.functions, functionIndex)
+	delete(idx.parsed, functionIndex)
+	return nil
+}
+
+func (idx *MemoryIndex) ListFunctions() (map[string]string, error) {
+	return idx.ListFunctionsContext(context.Background())
+}
+
+func (idx *MemoryIndex) ListFunctionsContext(ctx context.Context) (map[string]string, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if err := idx.check(ctx); err != nil {
+		return nil, err
+	}
+	m := make(map[string]string, len(idx.functions))
+	for k, v := range idx.functions {
+		m[strconv.Itoa(k)] = v
+	}
+	return m, nil
+}
+
+func (idx *MemoryIndex) Search(queryString string) (SearchResults, error) {
+	return idx.SearchWithQueryContext(context.Background(), QueryForString(queryString))
+}
+
+func (idx *MemoryIndex) SearchContext(ctx context.Context, queryString string) (SearchResults, error) {
+	return idx.SearchWithQueryContext(ctx, QueryForString(queryString))
+}
+
+func (idx *MemoryIndex) SearchWithQuery(query Query) (SearchResults, error) {
+	return idx.SearchWithQueryContext(context.Background(), query)
+}
+
+func (idx *MemoryIndex) SearchWithQueryContext(ctx context.Context, query Query) (SearchResults, error) {
+	began := time.Now()
+	q, err := queryStateOf(query)
+	if err != nil {
+		return nil, err
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if err := idx.check(ctx); err != nil {
+		return nil, err
+	}
+	matches, s, err := idx.match(q)
+	if err != nil {
+		return nil, err
+	}
+
+	sr := &searchResults{
+		Matches: int64(len(matches)),
+		Query:   q.queryString,
+		Facets:  map[string]map[string]int{},
+		Results: []map[string]interface{}{},
+	}
+	for _, m := range matches {
+		for k, v := range m.doc.doc.Categories {
+			if sr.Facets[k] == nil {
+				sr.Facets[k] = map[string]int{}
+			}
+			sr.Facets[k][v]++
+		}
+	}
+	end := q.start + q.length
+	if end > len(matches) {
+		end = len(matches)
+	}
+	for i := q.start; i < end; i++ {
+		sr.Results = append(sr.Results, s.result(q, matches[i]))
+	}
+	empty := ""
+	sr.DidYouMean = &empty
+	sr.SearchTime = strconv.FormatFloat(time.Since(began).Seconds(), 'f', 3, 64)
+	sr.hits = make([]Hit, len(sr.Results))
+	for i, result := range sr.Results {
+		sr.hits[i] = newHit(result)
+	}
+	return sr, nil
+}
+
+func (idx *MemoryIndex) DeleteBySearch(query Query) (int, error) {
+	return idx.DeleteBySearchContext(context.Background(), query)
+}
+
+func (idx *MemoryIndex) DeleteBySearchContext(ctx context.Context, query Query) (int, error) {
+	q, err := queryStateOf(query)
+	if err != nil {
+		return 0, err
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if err := idx.check(ctx); err != nil {
+		return 0, err
+	}
+	matches, _, err := idx.match(q)
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for i := q.start; i < len(matches); i++ {
+		delete(idx.docs, matches[i].doc.doc.Id)
+		deleted++
+	}
+	return deleted, nil
+}
+
+// queryStateOf returns the state of a query, decoding the parameters of Query implementations
+// other than the one returned by QueryForString.
+func queryStateOf(query Query) (*queryState, error) {
+	if q, ok := query.(*queryState); ok {
+		return q, nil
+	}
+	q, err := parseQueryParams(query.ToQueryParams())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	return q, nil
+}
+
+type memMatch struct {
+	doc       *memDoc
+	relevance float64
+	score     float64
+}
+
+// memSearch holds the state of one search.
+type memSearch struct {
+	idx  *MemoryIndex
+	expr QueryExpr
+	df   map[string]int // field + "\x00" + word -> number of documents containing it
+}
+
+// match returns the documents matching a query and its filters, ranked by its scoring function.
+// Callers hold idx.mu.
+func (idx *MemoryIndex) match(q *queryState) ([]memMatch, *memSearch, error) {
+	expr, err := ParseQueryExpr(q.queryString)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	if q.start < 0 || q.length < 0 {
+		return nil, nil, fmt.Errorf("%w: invalid start or len", ErrInvalidQuery)
+	}
+	function, ok := idx.parsed[q.scoringFunction]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: scoring function %d is not defined", ErrInvalidQuery, q.scoringFunction)
+	}
+	for _, r := range q.functionFilters {
+		if _, ok := idx.parsed[r.id]; !ok {
+			return nil, nil, fmt.Errorf("%w: scoring function %d is not defined", ErrInvalidQuery, r.id)
+		}
+	}
+
+	s := &memSearch{idx: idx, expr: expr, df: map[string]int{}}
+	now := float64(idx.now().Unix())
+	var matches []memMatch
+	for _, d := range idx.docs {
+		ok, relevance := s.eval(expr, d, defaultSearchField)
+		if !ok || !matchesCategories(d, q.categoryFilters) || !inRanges(q.docvarFilters, func(n int) float64 { return d.vars[n] }) {
+			continue
+		}
+		env := ScoreEnv{Relevance: relevance, Age: now - d.timestamp, DocVars: d.vars, QueryVars: q.queryVariables}
+		if !inRanges(q.functionFilters, func(n int) float64 { return evalScore(idx.parsed[n], &env) }) {
+			continue
+		}
+		matches = append(matches, memMatch{d, relevance, evalScore(function, &env)})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].doc.doc.Id < matches[j].doc.doc.Id
+	})
+	return matches, s, nil
+}
+
+func matchesCategories(d *memDoc, filters map[string][]string) bool {
+	for category, values := range filters {
+		value, ok := d.doc.Categories[category]
+		if !ok {
+			return false
+		}
+		found := false
+		for _, v := range values {
+			if v == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// inRanges returns whether, for every variable with ranges, its value is within any of them.
+func inRanges(ranges []varRange, value func(n int) float64) bool {
+	byId := map[int][]varRange{}
+	for _, r := range ranges {
+		byId[r.id] = append(byId[r.id], r)
+	}
+	for n, rs := range byId {
+		v := value(n)
+		found := false
+		for _, r := range rs {
+			if v >= r.floor && v <= r.ceil {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// eval returns whether a document matches a query expression, and its relevance.
+func (s *memSearch) eval(expr QueryExpr, d *memDoc, field string) (bool, float64) {
+	switch e := expr.(type) {
+	case *TermExpr:
+		if field == "docid" {
+			return e.Text == d.doc.Id, 1
+		}
+		words := tokenize(e.Text)
+		if len(words) == 1 {
+			return s.termScore(field, words[0], d, false)
+		}
+		return s.phraseScore(field, words, d)
+	case *PrefixExpr:
+		if field == "docid" {
+			return strings.HasPrefix(d.doc.Id, e.Text), 1
+		}
+		words := tokenize(e.Text)
+		if len(words) != 1 {
+			return false, 0
+		}
+		return s.termScore(field, words[0], d, true)
+	case *PhraseExpr:
+		if field == "docid" {
+			return e.Text == d.doc.Id, 1
+		}
+		return s.phraseScore(field, tokenize(e.Text), d)
+	case *FieldExpr:
+		return s.eval(e.Expr, d, e.Field)
+	case *BoostExpr:
+		ok, score := s.eval(e.Expr, d, field)
+		return ok, score * e.Boost
+	case *NotExpr:
+		ok, _ := s.eval(e.Expr, d, field)
+		return !ok, 0
+	case *AndExpr:
+		total := 0.0
+		for _, sub := range e.Exprs {
+			ok, score := s.eval(sub, d, field)
+			if !ok {
+				return false, 0
+			}
+			total += score
+		}
+		return true, total
+	case *OrExpr:
+		matched, total := false, 0.0
+		for _, sub := range e.Exprs {
+			if ok, score := s.eval(sub, d, field); ok {
+				matched = true
+				total += score
+			}
+		}
+		return matched, total
+	}
+	return false, 0
+}
+
+// termScore scores a single word, or a word prefix, with a tf-idf like formula.
+func (s *memSearch) termScore(field, word string, d *memDoc, prefix bool) (bool, float64) {
+	tf := 0
+	for _, w := range d.tokens[field] {
+		if w == word || prefix && strings.HasPrefix(w, word) {
+			tf++
+		}
+	}
+	if tf == 0 {
+		return false, 0
+	}
+	key := field + "\x00" + word
+	if prefix {
+		key += "*"
+	}
+	df, ok := s.df[key]
+	if !ok {
+		for _, other := range s.idx.docs {
+			for _, w := range other.tokens[field] {
+				if w == word || prefix && strings.HasPrefix(w, word) {
+					df++
+					break
+				}
+			}
+		}
+		s.df[key] = df
+	}
+	idf := 1 + math.Log(float64(len(s.idx.docs))/float64(df+1)+1)
+	return true, math.Sqrt(float64(tf)) * idf
+}
+
+// phraseScore scores a sequence of words, which must appear next to each other.
+func (s *memSearch) phraseScore(field string, words []string, d *memDoc) (bool, float64) {
+	if len(words) == 0 {
+		return false, 0
+	}
+	tokens := d.tokens[field]
+	count := 0
+	for i := 0; i+len(words) <= len(tokens); i++ {
+		found := true
+		for j, w := range words {
+			if tokens[i+j] != w {
+				found = false
+				break
+			}
+		}
+		if found {
+			count++
+		}
+	}
+	if count == 0 {
+		return false, 0
+	}
+	total := 0.0
+	for _, w := range words {
+		_, score := s.termScore(field, w, d, false)
+		total += score
+	}
+	return true, total * math.Sqrt(float64(count))
+}
+
+// result builds the raw search result of a match, as the server would return it.
+func (s *memSearch) result(q *queryState, m memMatch) map[string]interface{} {
+	d := m.doc
+	r := map[string]interface{}{
+		docidKey: d.doc.Id,
+		scoreKey: m.score,
+	}
+	for _, f := range q.fetchFields {
+		if f == "*" {
+			for k, v := range d.doc.Fields {
+				r[k] = v
+			}
+		} else if v, ok := d.doc.Fields[f]; ok {
+			r[f] = v
+		}
+	}
+	if q.fetchVariables {
+		for k, v := range d.vars {
+			r[variablePrefix+strconv.Itoa(k)] = v
+		}
+	}
+	if q.fetchCategories {
+		for k, v := range d.doc.Categories {
+			r[categoryPrefix+k] = v
+		}
+	}
+	for _, f := range q.snippetFields {
+		if text, ok := d.doc.Fields[f]; ok {
+			r[snippetPrefix+f] = snippet(text, queryWords(s.expr, f, defaultSearchField))
+		}
+	}
+	return r
+}
+
+// queryWords returns the words and word prefixes (ending in "*") searched for in a field.
+func queryWords(expr QueryExpr, field, current string) map[string]bool {
+	words := map[string]bool{}
+	var walk func(e QueryExpr, f string)
+	walk = func(e QueryExpr, f string) {
+		switch x := e.(type) {
+		case *TermExpr:
+			if f == field {
+				for _, w := range tokenize(x.Text) {
+					words[w] = true
+				}
+			}
+		case *PhraseExpr:
+			if f == field {
+				for _, w := range tokenize(x.Text) {
+					words[w] = true
+				}
+			}
+		case *PrefixExpr:
+			if f == field {
+				for _, w := range tokenize(x.Text) {
+					words[w+"*"] = true
+				}
+			}
+		case *FieldExpr:
+			walk(x.Expr, x.Field)
+		case *BoostExpr:
+			walk(x.Expr, f)
+		case *AndExpr:
+			for _, sub := range x.Exprs {
+				walk(sub, f)
+			}
+		case *OrExpr:
+			for _, sub := range x.Exprs {
+				walk(sub, f)
+			}
+		}
+	}
+	walk(expr, current)
+	return words
+}
+
+// snippet returns text, HTML escaped, with the given words highlighted in <b> tags.
+func snippet(text string, words map[string]bool) string {
+	var b strings.Builder
+	start := -1
+	flush := func(end int) {
+		word := text[start:end]
+		lower := strings.ToLower(word)
+		highlight := words[lower]
+		for w := range words {
+			if strings.HasSuffix(w, "*") && strings.HasPrefix(lower, w[:len(w)-1]) {
+				highlight = true
+			}
+		}
+		if highlight {
+			b.WriteString("<b>" + html.EscapeString(word) + "</b>")
+		} else {
+			b.WriteString(html.EscapeString(word))
+		}
+		start = -1
+	}
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			flush(i)
+		}
+		b.WriteString(html.EscapeString(string(r)))
+	}
+	if start >= 0 {
+		flush(len(text))
+	}
+	return b.String()
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// tokenize splits text into lower cased words.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !isWordRune(r)
+	})
+}
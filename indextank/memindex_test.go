@@ -0,0 +1,208 @@
+package indextank
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// searchDocids returns the docids of the hits of query, in order.
+func searchDocids(t *testing.T, idx Index, query Query) []string {
+	t.Helper()
+	results, err := idx.SearchWithQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var docids []string
+	for _, hit := range results.GetHits() {
+		docids = append(docids, hit.Docid)
+	}
+	return docids
+}
+
+func TestMemoryIndexRelevance(t *testing.T) {
+	idx := NewMemoryIndex()
+	if err := idx.AddFunction(1, "relevance"); err != nil {
+		t.Fatal(err)
+	}
+	docs := map[string]string{
+		"once":  "gopher and other animals",
+		"twice": "gopher gopher and other animals",
+		"rare":  "animals like the capybara",
+		"none":  "nothing to see here",
+	}
+	for docid, text := range docs {
+		if err := idx.AddDocument(docid, map[string]string{"text": text}, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// more occurrences rank higher
+		{"gopher", []string{"twice", "once"}},
+		// a rarer word weighs more than a common one
+		{"animals OR capybara", []string{"rare", "once", "twice"}},
+		{"animals AND NOT gopher", []string{"rare"}},
+		{"text:gopher", []string{"twice", "once"}},
+		{`"other animals"`, []string{"once", "twice"}},
+		{"capy*", []string{"rare"}},
+		{"docid:none", []string{"none"}},
+	}
+	for _, test := range tests {
+		query := QueryForString(test.query)
+		query.ScoringFunction(1)
+		if got := searchDocids(t, idx, query); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("search %q = %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestMemoryIndexFilters(t *testing.T) {
+	idx := NewMemoryIndex()
+	if err := idx.AddFunction(1, "doc.var[0]"); err != nil {
+		t.Fatal(err)
+	}
+	add := func(docid string, price float32, color string) {
+		t.Helper()
+		err := idx.AddDocument(docid, map[string]string{"text": "shirt"}, map[int]float32{0: price}, map[string]string{"color": color})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("cheap-red", 5, "red")
+	add("mid-blue", 20, "blue")
+	add("dear-red", 50, "red")
+	add("dear-green", 80, "green")
+
+	tests := []struct {
+		setup func(q Query)
+		want  []string
+	}{
+		{func(q Query) {}, []string{"dear-green", "dear-red", "mid-blue", "cheap-red"}},
+		{func(q Query) { q.CategoryFilter(map[string][]string{"color": {"red"}}) }, []string{"dear-red", "cheap-red"}},
+		{func(q Query) { q.CategoryFilter(map[string][]string{"color": {"red", "blue"}}) }, []string{"dear-red", "mid-blue", "cheap-red"}},
+		{func(q Query) { q.DocumentVariableFilter(0, 10, 60) }, []string{"dear-red", "mid-blue"}},
+		{func(q Query) { q.DocumentVariableRanges(0, AtMost(5), AtLeast(60)) }, []string{"dear-green", "cheap-red"}},
+		{func(q Query) { q.FunctionRanges(1, Between(20, 50)) }, []string{"dear-red", "mid-blue"}},
+		{func(q Query) {
+			q.CategoryFilter(map[string][]string{"color": {"red"}})
+			q.DocumentVariableFilter(0, 10, 100)
+		}, []string{"dear-red"}},
+	}
+	for i, test := range tests {
+		query := QueryForString("shirt")
+		query.ScoringFunction(1)
+		test.setup(query)
+		if got := searchDocids(t, idx, query); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%d: %s = %v, want %v", i, query.ToQueryParams(), got, test.want)
+		}
+	}
+
+	results, err := idx.Search("shirt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]int{"color": {"red": 2, "blue": 1, "green": 1}}
+	if facets := results.GetFacets(); !reflect.DeepEqual(facets, want) {
+		t.Errorf("facets = %v, want %v", facets, want)
+	}
+}
+
+// TestMemoryIndexConcurrent is meant to be run with -race.
+func TestMemoryIndexConcurrent(t *testing.T) {
+	idx := NewMemoryIndex()
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				docid := fmt.Sprintf("doc-%d-%d", w, i)
+				if err := idx.AddDocument(docid, map[string]string{"text": "hello"}, map[int]float32{0: float32(i)}, nil); err != nil {
+					t.Error(err)
+					return
+				}
+				if i%5 == 0 {
+					idx.UpdateVariables(docid, map[int]float32{0: -1})
+					idx.DeleteDocument(docid)
+				}
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				query := QueryForString("hello")
+				query.FetchVariables()
+				if _, err := idx.SearchWithQuery(query); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	results, err := idx.Search("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := results.GetMatches(); got != 4*40 {
+		t.Errorf("%d matches, want %d", got, 4*40)
+	}
+}
+
+func TestMemoryIndexSnapshot(t *testing.T) {
+	idx := NewMemoryIndex()
+	if err := idx.UpdateIndex(map[string]interface{}{"public_search": true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.AddFunction(1, "relevance * d[0]"); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.AddDocument("b", map[string]string{"text": "blue shirt"}, map[int]float32{0: 5}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.AddDocument("a", map[string]string{"text": "red shirt", "timestamp": "1000"}, map[int]float32{0: 2}, map[string]string{"color": "red"}); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := idx.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Documents) != 2 || snapshot.Documents[0].Id != "a" || snapshot.Documents[0].Timestamp != 1000 {
+		t.Errorf("snapshot documents = %+v, want a, with timestamp 1000, then b", snapshot.Documents)
+	}
+
+	restored, err := RestoreMemoryIndex(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := restored.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again.CreationTime = snapshot.CreationTime
+	if !reflect.DeepEqual(again, snapshot) {
+		t.Errorf("restored snapshot:\n%+v\nwant\n%+v", again, snapshot)
+	}
+	query := QueryForString("shirt")
+	query.ScoringFunction(1)
+	if got := searchDocids(t, restored, query); !reflect.DeepEqual(got, []string{"b", "a"}) {
+		t.Errorf("restored index search = %v, want [b a]", got)
+	}
+
+	// the snapshot doesn't share data with the index
+	snapshot.Documents[0].Fields["text"] = "changed"
+	if got := searchDocids(t, idx, QueryForString("changed")); len(got) != 0 {
+		t.Errorf("changing the snapshot changed the index: %v", got)
+	}
+
+	snapshot.Functions[2] = "log("
+	if _, err := RestoreMemoryIndex(snapshot); err == nil {
+		t.Error("RestoreMemoryIndex accepted an invalid function")
+	}
+}
@@ -0,0 +1,91 @@
+package indextank
+
+import (
+	"net/http"
+	"time"
+)
+
+// Operation identifies a group of API calls, so that each group can have its own timeout.
+type Operation int
+
+const (
+	// OperationAdmin covers creating, updating, deleting and listing indexes and reading index metadata.
+	OperationAdmin Operation = iota
+	// OperationIndexing covers adding and deleting documents and updating variables and categories.
+	OperationIndexing
+	// OperationFunctions covers adding, deleting and listing scoring functions.
+	OperationFunctions
+	// OperationSearch covers searches.
+	OperationSearch
+)
+
+func (op Operation) String() string {
+	switch op {
+	case OperationAdmin:
+		return "admin"
+	case OperationIndexing:
+		return "indexing"
+	case OperationFunctions:
+		return "functions"
+	case OperationSearch:
+		return "search"
+	}
+	return "unknown"
+}
+
+// A ClientOption configures an ApiClient created with NewApiClientWithOptions.
+type ClientOption func(*connection)
+
+// WithHTTPClient makes the ApiClient, and every Index it hands out, send requests through c
+// instead of http.DefaultClient.
+func WithHTTPClient(c *http.Client) ClientOption {
+	return func(conn *connection) {
+		conn.httpClient = c
+	}
+}
+
+// WithTransport sends requests through a copy of the configured http.Client using rt as its transport.
+func WithTransport(rt http.RoundTripper) ClientOption {
+	return func(conn *connection) {
+		c := http.Client{}
+		if conn.httpClient != nil {
+			c = *conn.httpClient
+		}
+		c.Transport = rt
+		conn.httpClient = &c
+	}
+}
+
+// WithTimeout sets a timeout for every request that has no operation specific timeout.
+// A zero duration means no timeout.
+func WithTimeout(d time.Duration) ClientOption {
+	return func(conn *connection) {
+		conn.timeout = d
+	}
+}
+
+// WithOperationTimeout sets the timeout for requests of a given operation, e.g. a short one for
+// OperationSearch and a longer one for OperationIndexing.
+func WithOperationTimeout(op Operation, d time.Duration) ClientOption {
+	return func(conn *connection) {
+		if conn.timeouts == nil {
+			conn.timeouts = make(map[Operation]time.Duration)
+		}
+		conn.timeouts[op] = d
+	}
+}
+
+// WithUserAgent appends suffix to the User-Agent header, e.g. "myapp/1.2".
+func WithUserAgent(suffix string) ClientOption {
+	return func(conn *connection) {
+		conn.userAgent = userAgent + " " + suffix
+	}
+}
+
+// WithDocumentLimits sets the limits documents are validated against before they are added, instead of
+// DefaultDocumentLimits.
+func WithDocumentLimits(limits DocumentLimits) ClientOption {
+	return func(conn *connection) {
+		conn.limits = &limits
+	}
+}
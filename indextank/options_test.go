@@ -0,0 +1,131 @@
+package indextank
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingTransport counts the requests sent through it.
+type countingTransport struct {
+	calls int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.calls, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newIndexesServer(agents chan<- string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if agents != nil {
+			agents <- r.Header.Get("User-Agent")
+		}
+		w.Write([]byte(`{}`))
+	}))
+}
+
+func TestWithHTTPClientAndTransport(t *testing.T) {
+	srv := newIndexesServer(nil)
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		option func(rt http.RoundTripper) ClientOption
+	}{
+		{"WithHTTPClient", func(rt http.RoundTripper) ClientOption { return WithHTTPClient(&http.Client{Transport: rt}) }},
+		{"WithTransport", WithTransport},
+	}
+	for _, test := range tests {
+		rt := &countingTransport{}
+		client, err := NewApiClientWithOptions(srv.URL, test.option(rt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.ListIndexes(); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if _, err := client.GetIndex("test").Search("hello"); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if rt.calls != 2 {
+			t.Errorf("%s: %d requests went through the transport, want 2", test.name, rt.calls)
+		}
+	}
+
+	// WithTransport keeps the settings of the client configured before it
+	base := &http.Client{Timeout: time.Minute}
+	conn := newConnection(WithHTTPClient(base), WithTransport(&countingTransport{}))
+	if conn.client() == base || conn.client().Timeout != time.Minute {
+		t.Errorf("WithTransport changed the client passed to WithHTTPClient or lost its timeout")
+	}
+}
+
+func TestWithUserAgent(t *testing.T) {
+	agents := make(chan string, 1)
+	srv := newIndexesServer(agents)
+	defer srv.Close()
+
+	for _, test := range []struct {
+		options []ClientOption
+		want    string
+	}{
+		{nil, userAgent},
+		{[]ClientOption{WithUserAgent("myapp/1.2")}, userAgent + " myapp/1.2"},
+	} {
+		client, err := NewApiClientWithOptions(srv.URL, test.options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.ListIndexes(); err != nil {
+			t.Fatal(err)
+		}
+		if got := <-agents; got != test.want {
+			t.Errorf("User-Agent = %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	var calls int32
+	srv := newBlockingServer(&calls)
+	defer srv.Close()
+
+	tests := []struct {
+		options     []ClientOption
+		searchFails bool
+		listFails   bool
+	}{
+		{[]ClientOption{WithTimeout(20 * time.Millisecond)}, true, true},
+		{[]ClientOption{WithOperationTimeout(OperationSearch, 20*time.Millisecond)}, true, false},
+		// an operation timeout of 0 turns the default one off
+		{[]ClientOption{WithTimeout(20 * time.Millisecond), WithOperationTimeout(OperationAdmin, 0)}, true, false},
+	}
+	for i, test := range tests {
+		client, err := NewApiClientWithOptions(srv.URL, test.options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.GetIndex("test").Search("hello")
+		if fails := err != nil; fails != test.searchFails {
+			t.Errorf("%d: Search = %v, want failure %v", i, err, test.searchFails)
+		}
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%d: Search = %v, want a deadline error", i, err)
+		}
+
+		// requests without a timeout are bounded by ctx; a timeout shows as an early return
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		start := time.Now()
+		client.ListIndexesContext(ctx)
+		cancel()
+		if listFails := time.Since(start) < 150*time.Millisecond; listFails != test.listFails {
+			t.Errorf("%d: ListIndexes timed out early: %v, want %v", i, listFails, test.listFails)
+		}
+	}
+}
@@ -3,7 +3,9 @@ package indextank
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -21,9 +23,13 @@ type Query interface {
 	QueryVariable(int, float64)
 	QueryVariables(map[int]float64)
 	DocumentVariableFilter(variable int, floor, ceil float64)
+	DocumentVariableRanges(variable int, ranges ...Range)
 	FunctionFilter(variable int, floor, ceil float64)
+	FunctionRanges(function int, ranges ...Range)
 	CategoryFilter(filters map[string][]string)
 	ToQueryParams() string
+	Clone() Query
+	Freeze() Query
 }
 
 type varRange struct {
@@ -45,6 +51,7 @@ type queryState struct {
 	docvarFilters []varRange
 	functionFilters []varRange
 	categoryFilters map[string][]string
+	frozen          bool
 }
 
 // Returns a Query for a given string.
@@ -59,57 +66,117 @@ func QueryForString(s string) Query {
 }
 
 func (q *queryState) Start(start int) {
+	q.mutable()
 	q.start = start
 }
 
 func (q *queryState) NumResults(length int) {
+	q.mutable()
 	q.length = length
 }
 
 func (q *queryState) FetchFields(fields ...string) {
-	q.fetchFields = fields
+	q.mutable()
+	q.fetchFields = append([]string(nil), fields...)
 }
 
 func (q *queryState) SnippetFields(fields ...string) {
-	q.snippetFields = fields
+	q.mutable()
+	q.snippetFields = append([]string(nil), fields...)
 }
 
 func (q *queryState) FetchVariables() {
+	q.mutable()
 	q.fetchVariables = true
 }
 
 func (q *queryState) FetchCategories() {
+	q.mutable()
 	q.fetchCategories = true
 }
 
 func (q *queryState) ScoringFunction(function int) Query {
+	q.mutable()
 	q.scoringFunction = function
 	return q
 }
 
 func (q *queryState) QueryVariables(variables map[int]float64) {
-	q.queryVariables = variables
+	q.mutable()
+	q.queryVariables = make(map[int]float64, len(variables))
+	for k, v := range variables {
+		q.queryVariables[k] = v
+	}
 }
 
 func (q *queryState) QueryVariable(variable int, val float64) {
+	q.mutable()
 	q.queryVariables[variable] = val
 }
 
 func (q *queryState) DocumentVariableFilter(variable int, floor, ceil float64) {
+	q.mutable()
 	q.docvarFilters = append(q.docvarFilters, varRange{variable, floor, ceil})
 }
 
+// DocumentVariableRanges filters results by ranges of a document variable. A document matches if its
+// value is in any of the ranges, including those of earlier calls for the same variable.
+func (q *queryState) DocumentVariableRanges(variable int, ranges ...Range) {
+	for _, r := range ranges {
+		q.DocumentVariableFilter(variable, r.Floor, r.Ceil)
+	}
+}
+
 func (q *queryState) FunctionFilter(variable int, floor, ceil float64) {
+	q.mutable()
 	q.functionFilters = append(q.functionFilters, varRange{variable, floor, ceil})
 }
 
+// FunctionRanges filters results by ranges of the value of a scoring function. A document matches if
+// the value is in any of the ranges, including those of earlier calls for the same function.
+func (q *queryState) FunctionRanges(function int, ranges ...Range) {
+	for _, r := range ranges {
+		q.FunctionFilter(function, r.Floor, r.Ceil)
+	}
+}
+
 func (q *queryState) CategoryFilter(filters map[string][]string) {
-	// todo
-	// if len(filters) > 0 {
-	//   q.categoryFilters.putAll(filters)
-	// }
+	q.mutable()
 	for k, v := range filters {
-		q.categoryFilters[k] = v
+		q.categoryFilters[k] = append([]string(nil), v...)
+	}
+}
+
+// Clone returns a copy of the query that can be modified without changing the original, even if
+// the original is frozen.
+func (q *queryState) Clone() Query {
+	c := *q
+	c.frozen = false
+	c.fetchFields = append([]string(nil), q.fetchFields...)
+	c.snippetFields = append([]string(nil), q.snippetFields...)
+	c.docvarFilters = append([]varRange(nil), q.docvarFilters...)
+	c.functionFilters = append([]varRange(nil), q.functionFilters...)
+	c.queryVariables = make(map[int]float64, len(q.queryVariables))
+	for k, v := range q.queryVariables {
+		c.queryVariables[k] = v
+	}
+	c.categoryFilters = make(map[string][]string, len(q.categoryFilters))
+	for k, v := range q.categoryFilters {
+		c.categoryFilters[k] = append([]string(nil), v...)
+	}
+	return &c
+}
+
+// Freeze makes the query read only, so it can be shared between goroutines, e.g. as a template
+// that each request clones and completes. Setters of a frozen query panic.
+func (q *queryState) Freeze() Query {
+	q.frozen = true
+	return q
+}
+
+func (q *queryState) mutable() {
+	if q.frozen {
+		panic("Can't modify a frozen Query, Clone it first")
 	}
 }
 
@@ -117,108 +184,153 @@ func (q *queryState) String() string {
 	return q.ToQueryParams()
 }
 
+// ToQueryParams encodes the query as URL parameters, sorted by name, so equal queries have equal
+// encodings, e.g. to use as cache keys.
 func (q *queryState) ToQueryParams() string {
 	params := map[string]string{}
 	params["q"] = q.queryString
-	s := "q=" + url.QueryEscape(q.queryString)
 	if q.start > 0 {
 		params["start"] = strconv.Itoa(q.start)
-		s += "&start=" + strconv.Itoa(q.start)
 	}
 	params["len"] = strconv.Itoa(q.length)
-	s += "&len=" + strconv.Itoa(q.length)
 	if q.scoringFunction > 0 {
 		params["function"] = strconv.Itoa(q.scoringFunction)
-		s += "&function=" + strconv.Itoa(q.scoringFunction)
 	}
-	if q.snippetFields != nil && len(q.snippetFields) > 0 {
+	if len(q.snippetFields) > 0 {
 		params["snippet"] = strings.Join(q.snippetFields, ",")
-		s += "&snippet=" + url.QueryEscape(strings.Join(q.snippetFields, ","))
 	}
-	if q.fetchFields != nil && len(q.fetchFields) > 0 {
+	if len(q.fetchFields) > 0 {
 		params["fetch"] = strings.Join(q.fetchFields, ",")
-		s += "&fetch=" + url.QueryEscape(strings.Join(q.fetchFields, ","))
-	}
-	if len(q.queryVariables) > 0 {
-		for k, v := range q.queryVariables {
-			params["var"+strconv.Itoa(k)] = fmt.Sprintf("%f", v)
-			// todo - format these the best way we can
-			//s += "&var" + strconv.Itoa(k) + "=" + fmt.Sprintf("%f",v)
-			s += "&var" + strconv.Itoa(k) + "=" + strconv.FormatFloat(v, 'g', -1, 64)
-		}
+	}
+	for k, v := range q.queryVariables {
+		params["var"+strconv.Itoa(k)] = strconv.FormatFloat(v, 'g', -1, 64)
 	}
 	if q.fetchVariables {
 		params["fetch_variables"] = "*"
-		s += "&fetch_variables=" + url.QueryEscape("*")
 	}
 	if q.fetchCategories {
 		params["fetch_categories"] = "*"
-		s += "&fetch_categories=" + url.QueryEscape("*")
 	}
-
 	if len(q.categoryFilters) > 0 {
-		val, err := json.Marshal(q.categoryFilters)
-		if err != nil {
-			fmt.Printf("Error marshalling category filters: %v\n", err)
-		}
+		// maps are encoded with sorted keys
+		val, _ := json.Marshal(q.categoryFilters)
 		params["category_filters"] = string(val)
-		s += "&category_filters" + url.QueryEscape(string(val))
 	}
-
-	if len(q.docvarFilters) > 0 {
-		fmt.Printf("*** Adding DocvarFilters: %v\n", q.docvarFilters)
-		rangeParams := formatRangeParam(q.docvarFilters)
-		for k, v := range rangeParams {
-			params["filter_docvar"+k] = v
-		}
-		/*
-			for _, v := range q.docvarFilters {
-				k := "filter_docvar" + strconv.Itoa(v.id)
-				newValue := strconv.FormatFloat(v.floor, 'g', -1, 64) + ":" + strconv.FormatFloat(v.ceil, 'g', -1, 64)
-				// was fmt.Sprintf("%f:%f", v.floor, v.ceil)
-				totalValue := newValue
-				if totalValue, ok := params[k]; ok {
-					totalValue += "," + newValue
-				}
-
-				fmt.Printf("docvar %d: [%v,%v]\n", v.id, v.floor, v.ceil)
-				//s += "&filter_docvar" + strconv.Itoa(k) + "=" + fmt.Sprintf("%f:%f", v.floor, v.ceil)
-				//params["filter_docvar"+strconv.Itoa(k)] = fmt.Sprintf("%f:%f", v.floor, v.ceil)
-				params[k] = totalValue
-			} */
-	}
-
-	if len(q.functionFilters) > 0 {
-		fmt.Printf("*** Adding FunctionFilters: %v\n", q.functionFilters)
-		rangeParams := formatRangeParam(q.functionFilters)
-		for k, v := range rangeParams {
-			params["filter_function"+k] = v
-		}
+	for k, v := range formatRangeParam(q.docvarFilters) {
+		params["filter_docvar"+k] = v
 	}
-
-	// todo: build a param map[string]string first, convert it to url params in a 2nd step to shorten code
-	// on the other hand, we lose explicit ordering if we do this.
-	s = toQueryString(params)
-
-	return s
+	for k, v := range formatRangeParam(q.functionFilters) {
+		params["filter_function"+k] = v
+	}
+	return toQueryString(params)
 }
 
+// formatRangeParam joins the ranges of each variable, keyed by variable number, e.g. "1:5,10:*".
 func formatRangeParam(ranges []varRange) map[string]string {
 	params := make(map[string]string)
 
 	for _, v := range ranges {
-		//k := prefix + strconv.Itoa(v.id)
 		k := strconv.Itoa(v.id)
-		// todo handle NEGATIVE_INFINITY and POSITIVE_INFINITY, replace with "*"
-		newValue := strconv.FormatFloat(v.floor, 'g', -1, 64) + ":" + strconv.FormatFloat(v.ceil, 'g', -1, 64)
-		totalValue := newValue
-		if totalValue, ok := params[k]; ok {
-			totalValue += "," + newValue
+		value := Range{v.floor, v.ceil}.String()
+		if previous, ok := params[k]; ok {
+			value = previous + "," + value
 		}
-		fmt.Printf("range_var %d: [%v,%v]\n", v.id, v.floor, v.ceil)
-		//s += "&filter_docvar" + strconv.Itoa(k) + "=" + fmt.Sprintf("%f:%f", v.floor, v.ceil)
-		//params["filter_docvar"+strconv.Itoa(k)] = fmt.Sprintf("%f:%f", v.floor, v.ceil)
-		params[k] = totalValue
+		params[k] = value
 	}
 	return params
 }
+
+// ParseQueryParams rebuilds a Query from its ToQueryParams encoding, e.g. to replay a logged query.
+// Errors wrap ErrInvalidQuery.
+func ParseQueryParams(s string) (Query, error) {
+	q, err := parseQueryParams(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	return q, nil
+}
+
+// parseQueryParams rebuilds the state of a query from its ToQueryParams encoding.
+func parseQueryParams(s string) (*queryState, error) {
+	values, err := url.ParseQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	q := QueryForString(values.Get("q")).(*queryState)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		value := values.Get(k)
+		switch {
+		case k == "q":
+		case k == "start":
+			q.start, err = strconv.Atoi(value)
+		case k == "len":
+			q.length, err = strconv.Atoi(value)
+		case k == "function":
+			q.scoringFunction, err = strconv.Atoi(value)
+		case k == "snippet":
+			q.snippetFields = strings.Split(value, ",")
+		case k == "fetch":
+			q.fetchFields = strings.Split(value, ",")
+		case k == "fetch_variables":
+			q.fetchVariables = value != "" && value != "false"
+		case k == "fetch_categories":
+			q.fetchCategories = value != "" && value != "false"
+		case k == "category_filters":
+			err = json.Unmarshal([]byte(value), &q.categoryFilters)
+		case strings.HasPrefix(k, "filter_docvar"):
+			q.docvarFilters, err = parseRangeParam(q.docvarFilters, k[len("filter_docvar"):], value)
+		case strings.HasPrefix(k, "filter_function"):
+			q.functionFilters, err = parseRangeParam(q.functionFilters, k[len("filter_function"):], value)
+		case strings.HasPrefix(k, "var"):
+			var n int
+			var f float64
+			n, err = strconv.Atoi(k[len("var"):])
+			if err == nil {
+				f, err = strconv.ParseFloat(value, 64)
+				q.queryVariables[n] = f
+			}
+		default:
+			err = fmt.Errorf("unknown query parameter %q", k)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid query parameter %s: %v", k, err)
+		}
+	}
+	return q, nil
+}
+
+// parseRangeParam parses a range parameter like "1:5,10:*" for variable id, appending to ranges.
+func parseRangeParam(ranges []varRange, id, value string) ([]varRange, error) {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range strings.Split(value, ",") {
+		bounds := strings.Split(r, ":")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("invalid range %q", r)
+		}
+		floor, err := parseBound(bounds[0], math.Inf(-1))
+		if err != nil {
+			return nil, err
+		}
+		ceil, err := parseBound(bounds[1], math.Inf(1))
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, varRange{n, floor, ceil})
+	}
+	return ranges, nil
+}
+
+func parseBound(s string, unbounded float64) (float64, error) {
+	if s == "*" || s == "" {
+		return unbounded, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
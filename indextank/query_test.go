@@ -0,0 +1,141 @@
+package indextank
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// fullQuery returns a query using every setter.
+func fullQuery() Query {
+	q := QueryForString("text:gopher OR title:\"go & tank\"")
+	q.Start(20)
+	q.NumResults(5)
+	q.FetchFields("title", "text")
+	q.SnippetFields("text")
+	q.FetchVariables()
+	q.FetchCategories()
+	q.ScoringFunction(2)
+	q.QueryVariables(map[int]float64{0: 30.25, 1: -97.75})
+	q.QueryVariable(2, 1e-7)
+	q.DocumentVariableRanges(0, AtMost(5), Between(10, 20))
+	q.DocumentVariableFilter(1, -1, 1)
+	q.FunctionRanges(2, AtLeast(0.5))
+	q.CategoryFilter(map[string][]string{"color": {"red", "blue"}, "size": {"xl"}})
+	return q
+}
+
+func TestParseQueryParams(t *testing.T) {
+	for _, q := range []Query{QueryForString("hello"), fullQuery()} {
+		params := q.ToQueryParams()
+		parsed, err := ParseQueryParams(params)
+		if err != nil {
+			t.Fatalf("ParseQueryParams(%s): %v", params, err)
+		}
+		if !reflect.DeepEqual(parsed, q) {
+			t.Errorf("ParseQueryParams(%s) = %+v, want %+v", params, parsed, q)
+		}
+		if got := parsed.ToQueryParams(); got != params {
+			t.Errorf("round trip = %s, want %s", got, params)
+		}
+	}
+
+	for _, params := range []string{"q=a&len=x", "q=a&unknown=1", "q=a&filter_docvar0=1", "q=a&var0=x", "q=a&category_filters=[", "%zz"} {
+		if _, err := ParseQueryParams(params); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("ParseQueryParams(%q) = %v, want ErrInvalidQuery", params, err)
+		}
+	}
+}
+
+func TestQueryEncodingStable(t *testing.T) {
+	want := fullQuery().ToQueryParams()
+	// maps are iterated in a different order each time
+	for i := 0; i < 50; i++ {
+		if got := fullQuery().ToQueryParams(); got != want {
+			t.Fatalf("encoding changed from %s to %s", want, got)
+		}
+	}
+	q := QueryForString("a")
+	q.CategoryFilter(map[string][]string{"b": {"2"}, "a": {"1"}})
+	q.QueryVariables(map[int]float64{1: 1, 0: math.Pi})
+	if got, want := q.ToQueryParams(), "category_filters=%7B%22a%22%3A%5B%221%22%5D%2C%22b%22%3A%5B%222%22%5D%7D&len=10&q=a&var0=3.141592653589793&var1=1"; got != want {
+		t.Errorf("ToQueryParams = %s, want %s", got, want)
+	}
+}
+
+func TestQueryClone(t *testing.T) {
+	q := fullQuery()
+	want := q.ToQueryParams()
+	c := q.Clone()
+	if !reflect.DeepEqual(c, q) {
+		t.Fatalf("Clone = %+v, want %+v", c, q)
+	}
+
+	// changing the clone, in place or by appending, leaves the original alone
+	cs := c.(*queryState)
+	cs.fetchFields[0] = "changed"
+	cs.snippetFields[0] = "changed"
+	cs.docvarFilters[0].floor = 100
+	cs.functionFilters[0].ceil = 100
+	cs.categoryFilters["color"][0] = "changed"
+	c.QueryVariable(0, 100)
+	c.DocumentVariableFilter(5, 0, 1)
+	c.FunctionFilter(5, 0, 1)
+	c.CategoryFilter(map[string][]string{"new": {"x"}})
+	if got := q.ToQueryParams(); got != want {
+		t.Errorf("changing the clone changed the original from %s to %s", want, got)
+	}
+
+	// and the other way round
+	c = q.Clone()
+	want = c.ToQueryParams()
+	qs := q.(*queryState)
+	qs.categoryFilters["size"][0] = "changed"
+	q.QueryVariable(1, 100)
+	q.FetchFields("other")
+	if got := c.ToQueryParams(); got != want {
+		t.Errorf("changing the original changed the clone from %s to %s", want, got)
+	}
+}
+
+func TestQueryFreeze(t *testing.T) {
+	q := fullQuery().Freeze()
+	want := q.ToQueryParams()
+	setters := map[string]func(){
+		"Start":                  func() { q.Start(1) },
+		"NumResults":             func() { q.NumResults(1) },
+		"FetchFields":            func() { q.FetchFields("a") },
+		"SnippetFields":          func() { q.SnippetFields("a") },
+		"FetchVariables":         func() { q.FetchVariables() },
+		"FetchCategories":        func() { q.FetchCategories() },
+		"ScoringFunction":        func() { q.ScoringFunction(1) },
+		"QueryVariable":          func() { q.QueryVariable(0, 1) },
+		"QueryVariables":         func() { q.QueryVariables(nil) },
+		"DocumentVariableFilter": func() { q.DocumentVariableFilter(0, 0, 1) },
+		"DocumentVariableRanges": func() { q.DocumentVariableRanges(0, AtLeast(1)) },
+		"FunctionFilter":         func() { q.FunctionFilter(0, 0, 1) },
+		"FunctionRanges":         func() { q.FunctionRanges(0, AtLeast(1)) },
+		"CategoryFilter":         func() { q.CategoryFilter(map[string][]string{"a": {"b"}}) },
+	}
+	for name, set := range setters {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s didn't panic on a frozen query", name)
+				}
+			}()
+			set()
+		}()
+	}
+	if got := q.ToQueryParams(); got != want {
+		t.Errorf("frozen query changed from %s to %s", want, got)
+	}
+
+	// a clone of a frozen query can be modified
+	c := q.Clone()
+	c.Start(1)
+	if c.ToQueryParams() == want {
+		t.Error("Start didn't change the clone")
+	}
+}
@@ -0,0 +1,251 @@
+package indextank
+
+import (
+	"strconv"
+	"strings"
+)
+
+// QueryExpr is a node of a search query in IndexTank query syntax. Build one with Term, Prefix, Phrase,
+// Field, DocId, And, Or, Not and Boost, or parse one with ParseQueryExpr, and search for it with QueryForExpr:
+//
+//	expr := indextank.And(
+//		indextank.Field("title", indextank.Phrase(userInput)),
+//		indextank.Not(indextank.Field("status", indextank.Term("draft"))))
+//	results, err := idx.SearchWithQuery(indextank.QueryForExpr(expr))
+//
+// String renders the expression, escaping user input so that it is always searched for literally.
+type QueryExpr interface {
+	String() string
+	// precedence of the expression, to decide where parentheses are needed
+	precedence() int
+}
+
+// Precedences of query expressions, from the loosest binding to the tightest.
+const (
+	precOr = iota + 1
+	precAnd
+	precNot
+	precBoost
+	precField
+	precAtom
+)
+
+// TermExpr matches documents containing a single word.
+type TermExpr struct {
+	Text string
+}
+
+// PrefixExpr matches documents containing a word starting with Text, e.g. foo*.
+type PrefixExpr struct {
+	Text string
+}
+
+// PhraseExpr matches documents containing a sequence of words.
+type PhraseExpr struct {
+	Text string
+}
+
+// FieldExpr restricts an expression to a document field, e.g. title:foo.
+type FieldExpr struct {
+	Field string
+	Expr  QueryExpr
+}
+
+// AndExpr matches documents matching all of its expressions.
+type AndExpr struct {
+	Exprs []QueryExpr
+}
+
+// OrExpr matches documents matching any of its expressions.
+type OrExpr struct {
+	Exprs []QueryExpr
+}
+
+// NotExpr excludes documents matching its expression. It can only be used within an AndExpr that
+// has at least one clause that is not a NotExpr.
+type NotExpr struct {
+	Expr QueryExpr
+}
+
+// BoostExpr multiplies the relevance contributed by its expression, e.g. foo^2.
+type BoostExpr struct {
+	Expr  QueryExpr
+	Boost float64
+}
+
+// Term returns an expression matching a single word. Characters with a meaning in the
+// query syntax are escaped.
+func Term(text string) QueryExpr {
+	return &TermExpr{text}
+}
+
+// Prefix returns an expression matching words starting with prefix, e.g. Prefix("goph") renders goph*.
+func Prefix(prefix string) QueryExpr {
+	return &PrefixExpr{prefix}
+}
+
+// Phrase returns an expression matching a sequence of words, e.g. "new york".
+func Phrase(text string) QueryExpr {
+	return &PhraseExpr{text}
+}
+
+// Field restricts expr to the given document field, e.g. Field("title", Term("foo")) renders title:foo.
+func Field(field string, expr QueryExpr) QueryExpr {
+	return &FieldExpr{field, expr}
+}
+
+// DocId returns an expression matching the document with the given id.
+func DocId(docid string) QueryExpr {
+	return Field("docid", Term(docid))
+}
+
+// And returns an expression matching documents that match all of exprs.
+func And(exprs ...QueryExpr) QueryExpr {
+	return &AndExpr{exprs}
+}
+
+// Or returns an expression matching documents that match any of exprs.
+func Or(exprs ...QueryExpr) QueryExpr {
+	return &OrExpr{exprs}
+}
+
+// Not returns an expression excluding documents that match expr, for use within And next to
+// clauses that are not negated: And(Term("a"), Not(Term("b"))) is valid, but a group of
+// negated clauses only, like Not(Term("b")) or Field("f", Not(Term("b"))), can never match and
+// is rejected by ValidateQueryExpr.
+func Not(expr QueryExpr) QueryExpr {
+	return &NotExpr{expr}
+}
+
+// Boost returns expr with its relevance multiplied by boost, e.g. foo^2.
+func Boost(expr QueryExpr, boost float64) QueryExpr {
+	return &BoostExpr{expr, boost}
+}
+
+// QueryForExpr returns a Query for a query expression.
+func QueryForExpr(expr QueryExpr) Query {
+	return QueryForString(expr.String())
+}
+
+// ValidateQueryExpr checks that an expression renders a query ParseQueryExpr accepts. It rejects
+// empty And and Or expressions and groups of Not clauses only. Error positions refer to the
+// rendered query.
+func ValidateQueryExpr(expr QueryExpr) error {
+	_, err := ParseQueryExpr(expr.String())
+	return err
+}
+
+// StrictQueryForExpr returns a Query for a query expression, like QueryForExpr, after checking it
+// with ValidateQueryExpr.
+func StrictQueryForExpr(expr QueryExpr) (Query, error) {
+	if err := ValidateQueryExpr(expr); err != nil {
+		return nil, err
+	}
+	return QueryForExpr(expr), nil
+}
+
+func (e *TermExpr) String() string {
+	if isOperator(e.Text) || e.Text == "" {
+		return quote(e.Text)
+	}
+	return escapeTerm(e.Text)
+}
+
+func (e *PrefixExpr) String() string {
+	return escapeTerm(e.Text) + "*"
+}
+
+func (e *PhraseExpr) String() string {
+	return quote(e.Text)
+}
+
+func (e *FieldExpr) String() string {
+	return escapeTerm(e.Field) + ":" + group(e.Expr, precAtom)
+}
+
+func (e *AndExpr) String() string {
+	return join(e.Exprs, " AND ", precAnd)
+}
+
+func (e *OrExpr) String() string {
+	return join(e.Exprs, " OR ", precOr)
+}
+
+func (e *NotExpr) String() string {
+	return "NOT " + group(e.Expr, precNot)
+}
+
+func (e *BoostExpr) String() string {
+	return group(e.Expr, precField) + "^" + strconv.FormatFloat(e.Boost, 'g', -1, 64)
+}
+
+func (e *TermExpr) precedence() int   { return precAtom }
+func (e *PrefixExpr) precedence() int { return precAtom }
+func (e *PhraseExpr) precedence() int { return precAtom }
+func (e *FieldExpr) precedence() int  { return precField }
+func (e *AndExpr) precedence() int {
+	if len(e.Exprs) == 1 {
+		return e.Exprs[0].precedence()
+	}
+	return precAnd
+}
+func (e *OrExpr) precedence() int {
+	if len(e.Exprs) == 1 {
+		return e.Exprs[0].precedence()
+	}
+	return precOr
+}
+func (e *NotExpr) precedence() int   { return precNot }
+func (e *BoostExpr) precedence() int { return precBoost }
+
+// group renders expr, in parentheses if it binds looser than prec.
+func group(expr QueryExpr, prec int) string {
+	if expr.precedence() < prec {
+		return "(" + expr.String() + ")"
+	}
+	return expr.String()
+}
+
+func join(exprs []QueryExpr, sep string, prec int) string {
+	parts := make([]string, 0, len(exprs))
+	for _, e := range exprs {
+		// operands at the same level need no parentheses: a AND b AND c
+		parts = append(parts, group(e, prec))
+	}
+	return strings.Join(parts, sep)
+}
+
+func isOperator(s string) bool {
+	return s == "AND" || s == "OR" || s == "NOT"
+}
+
+// characters with a meaning in the query syntax, which are escaped with a backslash within terms
+const specialChars = `\+-!():^[]"{}~*?|&/`
+
+func escapeTerm(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(specialChars, r) || isSpace(r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		if r == '"' || r == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' || r == '\v'
+}
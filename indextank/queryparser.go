@@ -0,0 +1,365 @@
+package indextank
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// QuerySyntaxError describes an invalid query string, as returned by ParseQueryExpr.
+type QuerySyntaxError struct {
+	// Byte offset in the query string where the problem was found
+	Pos     int
+	Message string
+}
+
+func (e *QuerySyntaxError) Error() string {
+	return fmt.Sprintf("query syntax error at position %d: %s", e.Pos, e.Message)
+}
+
+// ParseQueryExpr parses a query string in IndexTank query syntax, e.g.
+//
+//	title:"new york" AND (pizza OR pasta^2) NOT docid:123
+//
+// Adjacent clauses without an operator are combined with AND. Besides syntax errors, it rejects
+// queries that could never match anything because they only exclude documents, like "NOT a".
+// The expression's String method renders the query in a normalized form.
+func ParseQueryExpr(s string) (QueryExpr, error) {
+	tokens, err := lexQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, &QuerySyntaxError{0, "empty query"}
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &QuerySyntaxError{t.pos, "unexpected " + t.describe()}
+	}
+	return expr, nil
+}
+
+// NormalizeQuery parses a query string and renders it in normalized form, with explicit
+// operators, minimal parentheses and consistent escaping.
+func NormalizeQuery(s string) (string, error) {
+	expr, err := ParseQueryExpr(s)
+	if err != nil {
+		return "", err
+	}
+	return expr.String(), nil
+}
+
+// StrictQueryForString returns a Query for a given string, like QueryForString, after checking
+// it with ParseQueryExpr, so that invalid queries are rejected before they are sent.
+func StrictQueryForString(s string) (Query, error) {
+	if _, err := ParseQueryExpr(s); err != nil {
+		return nil, err
+	}
+	return QueryForString(s), nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokTerm
+	tokPrefix
+	tokPhrase
+	tokField
+	tokLParen
+	tokRParen
+	tokAnd
+	tokOr
+	tokNot
+	tokBoost
+)
+
+type queryToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t queryToken) describe() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokPhrase:
+		return "phrase " + quote(t.text)
+	case tokField:
+		return "field " + t.text + ":"
+	case tokBoost:
+		return "boost ^" + t.text
+	}
+	return strconv.Quote(t.text)
+}
+
+// characters that end a term
+const termDelimiters = `()":^`
+
+// characters that can't appear unescaped in a term
+const reservedChars = `[]{}~!|&/`
+
+func lexQuery(s string) ([]queryToken, error) {
+	var tokens []queryToken
+	i := 0
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case isSpace(r):
+			i += size
+		case r == '(':
+			tokens = append(tokens, queryToken{tokLParen, "(", i})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{tokRParen, ")", i})
+			i++
+		case r == '"':
+			start := i
+			var b strings.Builder
+			i++
+			closed := false
+			for i < len(s) {
+				r, size := utf8.DecodeRuneInString(s[i:])
+				if r == '\\' && i+1 < len(s) {
+					r, size = utf8.DecodeRuneInString(s[i+1:])
+					b.WriteRune(r)
+					i += 1 + size
+					continue
+				}
+				i += size
+				if r == '"' {
+					closed = true
+					break
+				}
+				b.WriteRune(r)
+			}
+			if !closed {
+				return nil, &QuerySyntaxError{start, "unterminated phrase"}
+			}
+			tokens = append(tokens, queryToken{tokPhrase, b.String(), start})
+		case r == '^':
+			start := i
+			i++
+			j := i
+			for j < len(s) && strings.IndexByte("0123456789.", s[j]) >= 0 {
+				j++
+			}
+			boost, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil || boost <= 0 {
+				return nil, &QuerySyntaxError{start, "boost must be followed by a positive number"}
+			}
+			tokens = append(tokens, queryToken{tokBoost, s[i:j], start})
+			i = j
+		case r == ':':
+			return nil, &QuerySyntaxError{i, "missing field name before ':'"}
+		case r == '-' || r == '+':
+			// -a excludes a, +a requires it, which is the default
+			if i+1 == len(s) || isSpace(rune(s[i+1])) {
+				return nil, &QuerySyntaxError{i, fmt.Sprintf("'%c' must be followed by a clause; escape it with \\ to search for it", r)}
+			}
+			if r == '-' {
+				tokens = append(tokens, queryToken{tokNot, "-", i})
+			}
+			i++
+		default:
+			start := i
+			var b strings.Builder
+			prefix := false
+			for i < len(s) {
+				r, size := utf8.DecodeRuneInString(s[i:])
+				if r == '\\' {
+					if i+1 == len(s) {
+						return nil, &QuerySyntaxError{i, "escape character at end of query"}
+					}
+					r, size = utf8.DecodeRuneInString(s[i+1:])
+					b.WriteRune(r)
+					i += 1 + size
+					continue
+				}
+				if isSpace(r) || strings.ContainsRune(termDelimiters, r) {
+					break
+				}
+				if strings.ContainsRune(reservedChars, r) {
+					return nil, &QuerySyntaxError{i, fmt.Sprintf("unexpected '%c'; escape it with \\ to search for it", r)}
+				}
+				if r == '*' || r == '?' {
+					next := i + size
+					if r == '*' && (next == len(s) || isSpace(rune(s[next])) || strings.ContainsRune(termDelimiters, rune(s[next]))) && b.Len() > 0 {
+						prefix = true
+						i = next
+						break
+					}
+					return nil, &QuerySyntaxError{i, fmt.Sprintf("unexpected '%c'; only a trailing * is supported, escape it with \\ to search for it", r)}
+				}
+				b.WriteRune(r)
+				i += size
+			}
+			text := b.String()
+			switch {
+			case i < len(s) && s[i] == ':' && !prefix:
+				tokens = append(tokens, queryToken{tokField, text, start})
+				i++
+			case prefix:
+				tokens = append(tokens, queryToken{tokPrefix, text, start})
+			case s[start:i] == "AND":
+				tokens = append(tokens, queryToken{tokAnd, text, start})
+			case s[start:i] == "OR":
+				tokens = append(tokens, queryToken{tokOr, text, start})
+			case s[start:i] == "NOT":
+				tokens = append(tokens, queryToken{tokNot, text, start})
+			default:
+				tokens = append(tokens, queryToken{tokTerm, text, start})
+			}
+		}
+	}
+	return append(tokens, queryToken{tokEOF, "", len(s)}), nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	i      int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.i]
+}
+
+func (p *queryParser) next() queryToken {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// or := and ("OR" and)*
+func (p *queryParser) parseOr() (QueryExpr, error) {
+	var exprs []QueryExpr
+	for {
+		expr, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+		if p.peek().kind != tokOr {
+			break
+		}
+		p.next()
+	}
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return &OrExpr{exprs}, nil
+}
+
+// and := unary (["AND"] unary)*
+func (p *queryParser) parseAnd() (QueryExpr, error) {
+	start := p.peek()
+	var exprs []QueryExpr
+	negated := 0
+	for {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+		if _, ok := expr.(*NotExpr); ok {
+			negated++
+		}
+
+		t := p.peek()
+		if t.kind == tokAnd {
+			p.next()
+			continue
+		}
+		if t.kind == tokEOF || t.kind == tokOr || t.kind == tokRParen {
+			break
+		}
+	}
+	if negated == len(exprs) {
+		return nil, &QuerySyntaxError{start.pos, "a query can't consist of excluded (NOT) clauses only"}
+	}
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return &AndExpr{exprs}, nil
+}
+
+// unary := ("NOT" | "-") unary | boosted
+func (p *queryParser) parseUnary() (QueryExpr, error) {
+	if p.peek().kind == tokNot {
+		p.next()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := expr.(*NotExpr); ok {
+			// NOT NOT a
+			return expr.(*NotExpr).Expr, nil
+		}
+		return &NotExpr{expr}, nil
+	}
+	return p.parseBoosted()
+}
+
+// boosted := primary ("^" number)?
+func (p *queryParser) parseBoosted() (QueryExpr, error) {
+	expr, err := p.parsePrimary(true)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind == tokBoost {
+		p.next()
+		boost, _ := strconv.ParseFloat(t.text, 64)
+		return &BoostExpr{expr, boost}, nil
+	}
+	return expr, nil
+}
+
+// primary := "(" or ")" | field ":" primary | term | prefix | phrase
+func (p *queryParser) parsePrimary(allowField bool) (QueryExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokTerm:
+		return &TermExpr{t.text}, nil
+	case tokPrefix:
+		return &PrefixExpr{t.text}, nil
+	case tokPhrase:
+		return &PhraseExpr{t.text}, nil
+	case tokField:
+		if !allowField {
+			return nil, &QuerySyntaxError{t.pos, "nested field " + t.text + ":"}
+		}
+		if t.text == "" {
+			return nil, &QuerySyntaxError{t.pos, "missing field name before ':'"}
+		}
+		expr, err := p.parsePrimary(false)
+		if err != nil {
+			return nil, err
+		}
+		return &FieldExpr{t.text, expr}, nil
+	case tokLParen:
+		if p.peek().kind == tokRParen {
+			return nil, &QuerySyntaxError{t.pos, "empty parentheses"}
+		}
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, &QuerySyntaxError{t.pos, "unbalanced '('"}
+		}
+		return expr, nil
+	case tokRParen:
+		return nil, &QuerySyntaxError{t.pos, "unbalanced ')'"}
+	case tokEOF:
+		return nil, &QuerySyntaxError{t.pos, "missing clause at end of query"}
+	}
+	return nil, &QuerySyntaxError{t.pos, "unexpected " + t.describe()}
+}
@@ -0,0 +1,120 @@
+package indextank
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{`a b`, `a AND b`},
+		{`a AND b OR c`, `a AND b OR c`},
+		{`title:"new york" AND (pizza OR pasta^2) NOT docid:123`, `title:"new york" AND (pizza OR pasta^2) AND NOT docid:123`},
+		{`-a b`, `NOT a AND b`},
+		{`NOT NOT a`, `a`},
+		{`a* OR "x y"`, `a* OR "x y"`},
+		{`f:(a OR b)`, `f:(a OR b)`},
+		{`(a OR b) AND (c OR d)`, `(a OR b) AND (c OR d)`},
+		{`((a))`, `a`},
+		{`a\:b`, `a\:b`},
+		{`"AND"`, `"AND"`},
+		{`a^1.5 text:foo^2`, `a^1.5 AND text:foo^2`},
+	}
+	for _, test := range tests {
+		got, err := NormalizeQuery(test.query)
+		if err != nil {
+			t.Errorf("NormalizeQuery(%q): %v", test.query, err)
+		} else if got != test.want {
+			t.Errorf("NormalizeQuery(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
+
+func TestParseQueryExprErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+	}{
+		{``, 0},
+		{`NOT a`, 0},
+		{`a OR NOT b`, 5},
+		{`f:(NOT x)`, 3},
+		{`(a`, 0},
+		{`a)`, 1},
+		{`()`, 0},
+		{`f:g:a`, 2},
+		{`:a`, 0},
+		{`a AND`, 5},
+		{`a OR`, 4},
+		{`"open`, 0},
+		{`a^`, 1},
+	}
+	for _, test := range tests {
+		_, err := ParseQueryExpr(test.query)
+		var se *QuerySyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("ParseQueryExpr(%q) = %v, want a QuerySyntaxError", test.query, err)
+		} else if se.Pos != test.pos {
+			t.Errorf("ParseQueryExpr(%q) error at %d (%v), want %d", test.query, se.Pos, err, test.pos)
+		}
+		if _, err := StrictQueryForString(test.query); err == nil {
+			t.Errorf("StrictQueryForString(%q) accepted an invalid query", test.query)
+		}
+	}
+}
+
+// TestQueryBuilderRoundTrip checks that the query builder and the parser agree: what the builder
+// renders parses back to the same query, and what the parser rejects ValidateQueryExpr rejects.
+func TestQueryBuilderRoundTrip(t *testing.T) {
+	valid := []QueryExpr{
+		Term("gopher"),
+		Term("AND"),
+		Term(`a:b (c) "d" -e`),
+		Prefix("goph"),
+		Phrase(`say "hi"`),
+		DocId("doc-1"),
+		Field("title", Or(Term("a"), Term("b"))),
+		Field("f", And(Term("a"), Not(Term("x")))),
+		And(Term("a"), Not(Term("b")), Not(Field("status", Term("draft")))),
+		Or(And(Term("a"), Term("b")), Term("c")),
+		And(Or(Term("a"), Term("b")), Or(Term("c"), Term("d"))),
+		Boost(Phrase("new york"), 2),
+		Boost(Or(Term("a"), Term("b")), 0.5),
+	}
+	for _, expr := range valid {
+		rendered := expr.String()
+		parsed, err := ParseQueryExpr(rendered)
+		if err != nil {
+			t.Errorf("ParseQueryExpr(%q): %v", rendered, err)
+			continue
+		}
+		if got := parsed.String(); got != rendered {
+			t.Errorf("round trip of %q gave %q", rendered, got)
+		}
+		if err := ValidateQueryExpr(expr); err != nil {
+			t.Errorf("ValidateQueryExpr(%q): %v", rendered, err)
+		}
+		if _, err := StrictQueryForExpr(expr); err != nil {
+			t.Errorf("StrictQueryForExpr(%q): %v", rendered, err)
+		}
+	}
+
+	invalid := []QueryExpr{
+		Not(Term("x")),
+		Field("f", Not(Term("x"))),
+		Or(Not(Term("a")), Term("b")),
+		And(Not(Term("a")), Not(Term("b"))),
+		And(),
+		Or(),
+	}
+	for _, expr := range invalid {
+		if err := ValidateQueryExpr(expr); err == nil {
+			t.Errorf("ValidateQueryExpr(%q) accepted a query the parser rejects", expr.String())
+		}
+		if _, err := StrictQueryForExpr(expr); err == nil {
+			t.Errorf("StrictQueryForExpr(%q) accepted an invalid query", expr.String())
+		}
+	}
+}
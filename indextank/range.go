@@ -0,0 +1,58 @@
+package indextank
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// Range is a range of values, bounds included, to filter results by with Query.DocumentVariableRanges
+// and Query.FunctionRanges. An infinite bound leaves the range open on that side.
+type Range struct {
+	Floor float64
+	Ceil  float64
+}
+
+// Between returns the range from floor to ceil.
+func Between(floor, ceil float64) Range {
+	return Range{floor, ceil}
+}
+
+// AtLeast returns the range of values greater than or equal to floor.
+func AtLeast(floor float64) Range {
+	return Range{floor, math.Inf(1)}
+}
+
+// AtMost returns the range of values less than or equal to ceil.
+func AtMost(ceil float64) Range {
+	return Range{math.Inf(-1), ceil}
+}
+
+// Since returns the range of times from t on, for variables holding seconds since the epoch like
+// those of MarshalDocument.
+func Since(t time.Time) Range {
+	return AtLeast(float64(t.Unix()))
+}
+
+// Until returns the range of times up to t, for variables holding seconds since the epoch.
+func Until(t time.Time) Range {
+	return AtMost(float64(t.Unix()))
+}
+
+// TimeBetween returns the range of times from start to end, for variables holding seconds since the epoch.
+func TimeBetween(start, end time.Time) Range {
+	return Between(float64(start.Unix()), float64(end.Unix()))
+}
+
+// String returns the range as the API expects it, e.g. "1.5:10" or "*:10" for AtMost(10).
+func (r Range) String() string {
+	return formatBound(r.Floor) + ":" + formatBound(r.Ceil)
+}
+
+func formatBound(f float64) string {
+	if math.IsInf(f, 0) {
+		return "*"
+	}
+	// not 'g', which writes times in seconds as e.g. 1.5778368e+09
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
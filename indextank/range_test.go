@@ -0,0 +1,89 @@
+package indextank
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// filterParams returns the filter parameters of the encoding of q.
+func filterParams(t *testing.T, q Query) map[string]string {
+	t.Helper()
+	values, err := url.ParseQuery(q.ToQueryParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := map[string]string{}
+	for k := range values {
+		if k != "q" && k != "len" && k != "function" {
+			params[k] = values.Get(k)
+		}
+	}
+	return params
+}
+
+func TestRangeParams(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2020, 1, 2, 0, 0, 0, 0, time.FixedZone("CET", 3600))
+	tests := []struct {
+		name  string
+		setup func(q Query)
+		want  map[string]string
+	}{
+		{"single range", func(q Query) { q.DocumentVariableRanges(0, Between(1.5, 10)) },
+			map[string]string{"filter_docvar0": "1.5:10"}},
+		{"filter", func(q Query) { q.DocumentVariableFilter(2, -3, 0) },
+			map[string]string{"filter_docvar2": "-3:0"}},
+		{"OR'ed ranges", func(q Query) { q.DocumentVariableRanges(1, Between(1, 5), Between(10, 20)) },
+			map[string]string{"filter_docvar1": "1:5,10:20"}},
+		{"OR'ed across calls", func(q Query) {
+			q.FunctionRanges(1, Between(1, 5))
+			q.FunctionFilter(1, 10, 20)
+		}, map[string]string{"filter_function1": "1:5,10:20"}},
+		{"open bounds", func(q Query) { q.DocumentVariableRanges(0, AtMost(5), AtLeast(60)) },
+			map[string]string{"filter_docvar0": "*:5,60:*"}},
+		{"since and until", func(q Query) {
+			q.DocumentVariableRanges(0, Since(start))
+			q.DocumentVariableRanges(1, Until(start))
+		}, map[string]string{"filter_docvar0": "1577836800:*", "filter_docvar1": "*:1577836800"}},
+		// times are converted to seconds since the epoch, whatever their location
+		{"time between", func(q Query) { q.DocumentVariableRanges(3, TimeBetween(start, end)) },
+			map[string]string{"filter_docvar3": "1577836800:1577919600"}},
+		{"variable and function", func(q Query) {
+			q.DocumentVariableRanges(0, AtLeast(2))
+			q.FunctionRanges(2, Between(0.25, 1))
+		}, map[string]string{"filter_docvar0": "2:*", "filter_function2": "0.25:1"}},
+	}
+	for _, test := range tests {
+		q := QueryForString("shirt")
+		test.setup(q)
+		if got := filterParams(t, q); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	q := QueryForString("shirt")
+	q.DocumentVariableRanges(0, AtMost(5), AtLeast(60))
+	if got, want := q.ToQueryParams(), "filter_docvar0=%2A%3A5%2C60%3A%2A&len=10&q=shirt"; got != want {
+		t.Errorf("ToQueryParams = %s, want %s", got, want)
+	}
+}
+
+func TestRangeString(t *testing.T) {
+	tests := []struct {
+		r    Range
+		want string
+	}{
+		{Between(1.5, 10), "1.5:10"},
+		{AtLeast(-2), "-2:*"},
+		{AtMost(1e10), "*:10000000000"},
+		{AtLeast(0.001), "0.001:*"},
+		{Range{}, "0:0"},
+	}
+	for _, test := range tests {
+		if got := test.r.String(); got != test.want {
+			t.Errorf("%+v.String() = %q, want %q", test.r, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package indextank
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Defaults used for zero RetryPolicy fields.
+const (
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 10 * time.Second
+	defaultMultiplier     = 2.0
+)
+
+// RetryPolicy controls how requests that fail with a transient error are retried.
+// Only idempotent requests (GET, PUT, DELETE and HEAD, which is every call of the IndexTank API)
+// are retried, after a network error or a 429 or 5xx response.
+type RetryPolicy struct {
+	// Maximum number of attempts, including the first one. Values below 2 disable retries.
+	MaxAttempts int
+	// Backoff before the second attempt. Defaults to 100ms.
+	InitialBackoff time.Duration
+	// Upper bound for the backoff between attempts. Defaults to 10s. A request whose response asks,
+	// with Retry-After, to wait longer than this is not retried.
+	MaxBackoff time.Duration
+	// Factor the backoff grows by after each attempt. Defaults to 2.
+	Multiplier float64
+	// If set, called after every attempt, including the last one.
+	OnAttempt func(RetryAttempt)
+}
+
+// RetryAttempt describes one attempt of a request, as passed to RetryPolicy.OnAttempt.
+type RetryAttempt struct {
+	// Attempt number, starting at 1
+	Attempt int
+	// HTTP method and URL (with the API key redacted) of the request
+	Method string
+	URL    string
+	// Response status code, or 0 if the request failed without a response
+	StatusCode int
+	// Network error of the attempt, if any
+	Err error
+	// Whether the request will be retried, and how long until the next attempt
+	WillRetry bool
+	Delay     time.Duration
+}
+
+// WithRetryPolicy retries requests that fail with a transient error according to policy.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(conn *connection) {
+		conn.retry = &policy
+	}
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "PUT", "DELETE", "OPTIONS":
+		return true
+	}
+	return false
+}
+
+func isRetryableStatus(status int) bool {
+	return status == 429 || status >= 500
+}
+
+// next decides whether an attempt should be retried and how long to wait before doing so,
+// and reports the attempt to OnAttempt. A nil policy never retries.
+func (p *RetryPolicy) next(ctx context.Context, attempt int, req *http.Request, resp *http.Response, err error) (time.Duration, bool) {
+	if p == nil {
+		return 0, false
+	}
+
+	retry := attempt < p.MaxAttempts && isIdempotent(req.Method) && ctx.Err() == nil
+	if err == nil {
+		retry = retry && isRetryableStatus(resp.StatusCode)
+	}
+
+	var delay time.Duration
+	if retry {
+		delay = p.backoff(attempt)
+		if resp != nil {
+			if after, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				delay = after
+			}
+		}
+		if delay > p.maxBackoff() {
+			retry = false
+			delay = 0
+		}
+		// don't start waiting for an attempt we know won't happen
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			retry = false
+			delay = 0
+		}
+	}
+
+	if p.OnAttempt != nil {
+		a := RetryAttempt{
+			Attempt:   attempt,
+			Method:    req.Method,
+			URL:       req.URL.Redacted(),
+			Err:       err,
+			WillRetry: retry,
+			Delay:     delay,
+		}
+		if resp != nil {
+			a.StatusCode = resp.StatusCode
+		}
+		p.OnAttempt(a)
+	}
+	return delay, retry
+}
+
+// backoff returns the jittered exponential backoff after the given attempt: a random
+// duration between half and all of InitialBackoff * Multiplier^(attempt-1), capped at MaxBackoff.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	initial, max, multiplier := p.InitialBackoff, p.maxBackoff(), p.Multiplier
+	if initial <= 0 {
+		initial = defaultInitialBackoff
+	}
+	if multiplier < 1 {
+		multiplier = defaultMultiplier
+	}
+
+	d := float64(initial)
+	for i := 1; i < attempt && d < float64(max); i++ {
+		d *= multiplier
+	}
+	if d > float64(max) {
+		d = float64(max)
+	}
+	return time.Duration(d/2 + rand.Float64()*d/2)
+}
+
+func (p *RetryPolicy) maxBackoff() time.Duration {
+	if p.MaxBackoff <= 0 {
+		return defaultMaxBackoff
+	}
+	return p.MaxBackoff
+}
+
+// parseRetryAfter parses a Retry-After header, which holds either a number of seconds or an HTTP date.
+func parseRetryAfter(s string, now time.Time) (time.Duration, bool) {
+	if s == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(s); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		d := t.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
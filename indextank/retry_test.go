@@ -0,0 +1,68 @@
+package indextank
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		retryAfter string
+		maxBackoff time.Duration
+		wantCalls  int32
+	}{
+		{"0", time.Second, 3},
+		{"1", 2 * time.Second, 2},
+		{"86400", time.Second, 1},
+		{"86400", 0, 1},
+	}
+	for _, test := range tests {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if n := atomic.AddInt32(&calls, 1); n < test.wantCalls || test.wantCalls == 1 {
+				w.Header().Set("Retry-After", test.retryAfter)
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{}`))
+		}))
+		client, err := NewApiClientWithOptions(srv.URL, WithRetryPolicy(RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     test.maxBackoff,
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		_, err = client.ListIndexesContext(context.Background())
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("Retry-After %s, MaxBackoff %v: waited %v", test.retryAfter, test.maxBackoff, elapsed)
+		}
+		if got := atomic.LoadInt32(&calls); got != test.wantCalls {
+			t.Errorf("Retry-After %s, MaxBackoff %v: %d requests, want %d", test.retryAfter, test.maxBackoff, got, test.wantCalls)
+		}
+		if test.wantCalls == 1 && err == nil {
+			t.Errorf("Retry-After %s, MaxBackoff %v: no error for a request that wasn't retried", test.retryAfter, test.maxBackoff)
+		}
+		srv.Close()
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	for i, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		attempt := i + 1
+		want *= time.Millisecond
+		for j := 0; j < 20; j++ {
+			if d := p.backoff(attempt); d < want/2 || d > want {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", attempt, d, want/2, want)
+			}
+		}
+	}
+}
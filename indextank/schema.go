@@ -0,0 +1,292 @@
+package indextank
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// ErrNotInSchema is wrapped by the errors of Schema methods for names the schema does not declare.
+var ErrNotInSchema = errors.New("not in the schema")
+
+// Schema names the fields, variables, categories and scoring functions of an index, so documents,
+// queries and functions can refer to variables and functions by name instead of by number:
+//
+//	schema := &indextank.Schema{
+//		Fields:         []string{"text", "title"},
+//		Variables:      map[string]int{"popularity": 0, "lat": 1, "lon": 2},
+//		QueryVariables: map[string]int{"lat": 0, "lon": 1},
+//		Categories:     []string{"color"},
+//		Functions:      map[string]int{"popular": 1, "nearby": 2},
+//	}
+//	err := schema.AddFunction(ctx, idx, "nearby", "-km(query.var[lat], query.var[lon], doc.var[lat], doc.var[lon])")
+//
+// Names that are not declared are rejected with an error wrapping ErrNotInSchema. NewDocument,
+// ResolveFunction and AddFunction check the schema with Validate first.
+type Schema struct {
+	// Document fields, including "timestamp" if documents set it
+	Fields []string
+	// Document variable numbers by name
+	Variables map[string]int
+	// Query variable numbers by name
+	QueryVariables map[string]int
+	// Category names
+	Categories []string
+	// Scoring function numbers by name
+	Functions map[string]int
+}
+
+// Validate checks that numbers are not negative, and that no two names share a number.
+func (s *Schema) Validate() error {
+	for _, m := range []struct {
+		kind    string
+		numbers map[string]int
+	}{{"variable", s.Variables}, {"query variable", s.QueryVariables}, {"function", s.Functions}} {
+		names := make([]string, 0, len(m.numbers))
+		for name := range m.numbers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		seen := map[int]string{}
+		for _, name := range names {
+			n := m.numbers[name]
+			if n < 0 {
+				return fmt.Errorf("Invalid schema: %s %q has negative number %d", m.kind, name, n)
+			}
+			if other, ok := seen[n]; ok {
+				return fmt.Errorf("Invalid schema: %ss %q and %q both have number %d", m.kind, other, name, n)
+			}
+			seen[n] = name
+		}
+	}
+	return nil
+}
+
+// Variable returns the number of a document variable.
+func (s *Schema) Variable(name string) (int, error) {
+	return lookupNumber(s.Variables, "variable", name)
+}
+
+// QueryVariable returns the number of a query variable.
+func (s *Schema) QueryVariable(name string) (int, error) {
+	return lookupNumber(s.QueryVariables, "query variable", name)
+}
+
+// Function returns the number of a scoring function.
+func (s *Schema) Function(name string) (int, error) {
+	return lookupNumber(s.Functions, "function", name)
+}
+
+func lookupNumber(numbers map[string]int, kind, name string) (int, error) {
+	n, ok := numbers[name]
+	if !ok {
+		return 0, fmt.Errorf("Unknown %s %q: %w", kind, name, ErrNotInSchema)
+	}
+	return n, nil
+}
+
+func (s *Schema) checkField(name string) error {
+	return checkName(s.Fields, "field", name)
+}
+
+func (s *Schema) checkCategory(name string) error {
+	return checkName(s.Categories, "category", name)
+}
+
+func checkName(names []string, kind, name string) error {
+	for _, n := range names {
+		if n == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown %s %q: %w", kind, name, ErrNotInSchema)
+}
+
+// NewDocument is like the NewDocument function, with variables keyed by name. It fails if a field,
+// variable or category is not in the schema.
+func (s *Schema) NewDocument(docid string, fields map[string]string, variables map[string]float32, categories map[string]string) (Document, error) {
+	if err := s.Validate(); err != nil {
+		return Document{}, err
+	}
+	for name := range fields {
+		if err := s.checkField(name); err != nil {
+			return Document{}, err
+		}
+	}
+	for name := range categories {
+		if err := s.checkCategory(name); err != nil {
+			return Document{}, err
+		}
+	}
+	vars := make(map[int]float32, len(variables))
+	for name, v := range variables {
+		n, err := s.Variable(name)
+		if err != nil {
+			return Document{}, err
+		}
+		vars[n] = v
+	}
+	return NewDocument(docid, fields, vars, categories)
+}
+
+// schemaVarRef matches variables referred to by name in scoring functions, e.g. doc.var[popularity] or q[lat].
+var schemaVarRef = regexp.MustCompile(`\b(doc\.var|d|query\.var|q)\s*\[\s*([A-Za-z_][A-Za-z0-9_]*)\s*\]`)
+
+// ResolveFunction replaces the variable names in a scoring function definition, e.g.
+// "log(doc.var[popularity])", with their numbers, and checks the result with ParseScoreFunction.
+// Variables referred to by number are left unchanged.
+func (s *Schema) ResolveFunction(definition string) (string, error) {
+	err := s.Validate()
+	if err != nil {
+		return "", err
+	}
+	resolved := schemaVarRef.ReplaceAllStringFunc(definition, func(ref string) string {
+		m := schemaVarRef.FindStringSubmatch(ref)
+		var n int
+		var lerr error
+		if m[1] == "doc.var" || m[1] == "d" {
+			n, lerr = s.Variable(m[2])
+		} else {
+			n, lerr = s.QueryVariable(m[2])
+		}
+		if lerr != nil && err == nil {
+			err = lerr
+		}
+		return fmt.Sprintf("%s[%d]", m[1], n)
+	})
+	if err != nil {
+		return "", err
+	}
+	if _, err := ParseScoreFunction(resolved); err != nil {
+		return "", err
+	}
+	return resolved, nil
+}
+
+// AddFunction resolves the variables and name of a scoring function with ResolveFunction and
+// Function, and adds it to idx.
+func (s *Schema) AddFunction(ctx context.Context, idx Index, name, definition string) error {
+	resolved, err := s.ResolveFunction(definition)
+	if err != nil {
+		return err
+	}
+	n, err := s.Function(name)
+	if err != nil {
+		return err
+	}
+	return idx.AddFunctionContext(ctx, n, resolved)
+}
+
+// SchemaQuery sets the options of a Query that refer to fields, variables, categories and functions
+// by name. Each method fails, leaving the query unchanged, if a name is not in the schema:
+//
+//	sq := schema.Query(indextank.QueryForString("gopher"))
+//	if err := sq.ScoringFunction("nearby"); err != nil { ... }
+//	if err := sq.QueryVariables(map[string]float64{"lat": 30.27, "lon": -97.74}); err != nil { ... }
+//	results, err := idx.SearchWithQuery(sq.Query())
+type SchemaQuery struct {
+	query  Query
+	schema *Schema
+}
+
+// Query returns a SchemaQuery setting the options of query.
+func (s *Schema) Query(query Query) *SchemaQuery {
+	return &SchemaQuery{query, s}
+}
+
+// Query returns the underlying query, e.g. to set options that don't take names or to search with it.
+func (sq *SchemaQuery) Query() Query {
+	return sq.query
+}
+
+// FetchFields sets the fields to fetch. "*" fetches all fields.
+func (sq *SchemaQuery) FetchFields(fields ...string) error {
+	for _, f := range fields {
+		if f == "*" {
+			continue
+		}
+		if err := sq.schema.checkField(f); err != nil {
+			return err
+		}
+	}
+	sq.query.FetchFields(fields...)
+	return nil
+}
+
+// SnippetFields sets the fields to return snippets of.
+func (sq *SchemaQuery) SnippetFields(fields ...string) error {
+	for _, f := range fields {
+		if err := sq.schema.checkField(f); err != nil {
+			return err
+		}
+	}
+	sq.query.SnippetFields(fields...)
+	return nil
+}
+
+// ScoringFunction sets the scoring function.
+func (sq *SchemaQuery) ScoringFunction(name string) error {
+	n, err := sq.schema.Function(name)
+	if err != nil {
+		return err
+	}
+	sq.query.ScoringFunction(n)
+	return nil
+}
+
+// QueryVariable sets a query variable.
+func (sq *SchemaQuery) QueryVariable(name string, value float64) error {
+	n, err := sq.schema.QueryVariable(name)
+	if err != nil {
+		return err
+	}
+	sq.query.QueryVariable(n, value)
+	return nil
+}
+
+// QueryVariables sets query variables.
+func (sq *SchemaQuery) QueryVariables(variables map[string]float64) error {
+	vars := make(map[int]float64, len(variables))
+	for name, v := range variables {
+		n, err := sq.schema.QueryVariable(name)
+		if err != nil {
+			return err
+		}
+		vars[n] = v
+	}
+	sq.query.QueryVariables(vars)
+	return nil
+}
+
+// DocumentVariableFilter adds a range of a document variable to filter results by.
+func (sq *SchemaQuery) DocumentVariableFilter(name string, floor, ceil float64) error {
+	n, err := sq.schema.Variable(name)
+	if err != nil {
+		return err
+	}
+	sq.query.DocumentVariableFilter(n, floor, ceil)
+	return nil
+}
+
+// FunctionFilter adds a range of a scoring function to filter results by.
+func (sq *SchemaQuery) FunctionFilter(name string, floor, ceil float64) error {
+	n, err := sq.schema.Function(name)
+	if err != nil {
+		return err
+	}
+	sq.query.FunctionFilter(n, floor, ceil)
+	return nil
+}
+
+// CategoryFilter filters results by category values.
+func (sq *SchemaQuery) CategoryFilter(filters map[string][]string) error {
+	for name := range filters {
+		if err := sq.schema.checkCategory(name); err != nil {
+			return err
+		}
+	}
+	sq.query.CategoryFilter(filters)
+	return nil
+}
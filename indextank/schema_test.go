@@ -0,0 +1,174 @@
+package indextank
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func newTestSchema() *Schema {
+	return &Schema{
+		Fields:         []string{"text", "title"},
+		Variables:      map[string]int{"popularity": 0, "lat": 1, "lon": 2},
+		QueryVariables: map[string]int{"lat": 0, "lon": 1},
+		Categories:     []string{"color"},
+		Functions:      map[string]int{"popular": 1, "nearby": 2},
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	if err := newTestSchema().Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+	// numbers are per kind, so a variable and a function may share one
+	if err := (&Schema{Variables: map[string]int{"a": 1}, Functions: map[string]int{"f": 1}}).Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	invalid := []Schema{
+		{Variables: map[string]int{"a": 0, "b": 0}},
+		{QueryVariables: map[string]int{"a": 3, "b": 3}},
+		{Functions: map[string]int{"f": 1, "g": 1}},
+		{Variables: map[string]int{"a": -1}},
+		{Functions: map[string]int{"f": -2}},
+	}
+	for _, s := range invalid {
+		if err := s.Validate(); err == nil {
+			t.Errorf("Validate accepted %+v", s)
+		}
+		if _, err := s.NewDocument("1", map[string]string{"text": "x"}, nil, nil); err == nil {
+			t.Errorf("NewDocument accepted invalid schema %+v", s)
+		}
+		if _, err := s.ResolveFunction("relevance"); err == nil {
+			t.Errorf("ResolveFunction accepted invalid schema %+v", s)
+		}
+	}
+}
+
+func TestSchemaResolveFunction(t *testing.T) {
+	schema := newTestSchema()
+	tests := []struct {
+		definition, want string
+	}{
+		{"log(doc.var[popularity])", "log(doc.var[0])"},
+		{"d[lat] + q[lon]", "d[1] + q[1]"},
+		{"-km(query.var[lat], query.var[lon], doc.var[ lat ], d[lon])", "-km(query.var[0], query.var[1], doc.var[1], d[2])"},
+		// numbers are left unchanged
+		{"doc.var[7] * q[2] + d[popularity]", "doc.var[7] * q[2] + d[0]"},
+		{"relevance", "relevance"},
+	}
+	for _, test := range tests {
+		got, err := schema.ResolveFunction(test.definition)
+		if err != nil {
+			t.Errorf("ResolveFunction(%q): %v", test.definition, err)
+		} else if got != test.want {
+			t.Errorf("ResolveFunction(%q) = %q, want %q", test.definition, got, test.want)
+		}
+	}
+
+	for _, definition := range []string{"d[nope]", "q[popularity]", "log(doc.var[lat]) + query.var[unknown]"} {
+		if _, err := schema.ResolveFunction(definition); !errors.Is(err, ErrNotInSchema) {
+			t.Errorf("ResolveFunction(%q) = %v, want ErrNotInSchema", definition, err)
+		}
+	}
+	var se *ScoreFunctionError
+	if _, err := schema.ResolveFunction("log(d[popularity]"); !errors.As(err, &se) {
+		t.Errorf("ResolveFunction of an invalid definition = %v, want a ScoreFunctionError", err)
+	}
+}
+
+func TestSchemaNewDocument(t *testing.T) {
+	schema := newTestSchema()
+	doc, err := schema.NewDocument("1", map[string]string{"text": "hi"}, map[string]float32{"lon": 2.5}, map[string]string{"color": "red"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(doc.NumberedVariables(), map[int]float32{2: 2.5}) || doc.Categories["color"] != "red" {
+		t.Errorf("NewDocument = %+v", doc)
+	}
+
+	for _, bad := range []struct {
+		fields     map[string]string
+		variables  map[string]float32
+		categories map[string]string
+	}{
+		{map[string]string{"body": "hi"}, nil, nil},
+		{map[string]string{"text": "hi"}, map[string]float32{"nope": 1}, nil},
+		{map[string]string{"text": "hi"}, nil, map[string]string{"size": "xl"}},
+	} {
+		if _, err := schema.NewDocument("1", bad.fields, bad.variables, bad.categories); !errors.Is(err, ErrNotInSchema) {
+			t.Errorf("NewDocument(%v, %v, %v) = %v, want ErrNotInSchema", bad.fields, bad.variables, bad.categories, err)
+		}
+	}
+}
+
+func TestSchemaAddFunction(t *testing.T) {
+	schema := newTestSchema()
+	idx := NewMemoryIndex()
+	ctx := context.Background()
+	if err := schema.AddFunction(ctx, idx, "popular", "log(doc.var[popularity])"); err != nil {
+		t.Fatal(err)
+	}
+	functions, err := idx.ListFunctions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if functions["1"] != "log(doc.var[0])" {
+		t.Errorf("functions = %v, want 1 defined as log(doc.var[0])", functions)
+	}
+	if err := schema.AddFunction(ctx, idx, "unknown", "relevance"); !errors.Is(err, ErrNotInSchema) {
+		t.Errorf("AddFunction of an unknown function = %v, want ErrNotInSchema", err)
+	}
+}
+
+func TestSchemaQuery(t *testing.T) {
+	schema := newTestSchema()
+	sq := schema.Query(QueryForString("gopher"))
+	steps := []error{
+		sq.FetchFields("title", "*"),
+		sq.SnippetFields("text"),
+		sq.ScoringFunction("nearby"),
+		sq.QueryVariables(map[string]float64{"lat": 30.25, "lon": -97.75}),
+		sq.DocumentVariableFilter("popularity", 1, 5),
+		sq.FunctionFilter("popular", 0, 10),
+		sq.CategoryFilter(map[string][]string{"color": {"red"}}),
+	}
+	for i, err := range steps {
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+	}
+	want := QueryForString("gopher")
+	want.FetchFields("title", "*")
+	want.SnippetFields("text")
+	want.ScoringFunction(2)
+	want.QueryVariables(map[int]float64{0: 30.25, 1: -97.75})
+	want.DocumentVariableFilter(0, 1, 5)
+	want.FunctionFilter(1, 0, 10)
+	want.CategoryFilter(map[string][]string{"color": {"red"}})
+	if got := sq.Query().ToQueryParams(); got != want.ToQueryParams() {
+		t.Errorf("query = %s, want %s", got, want.ToQueryParams())
+	}
+
+	// failing calls leave the query unchanged
+	before := sq.Query().ToQueryParams()
+	failures := []error{
+		sq.FetchFields("text", "body"),
+		sq.SnippetFields("body"),
+		sq.ScoringFunction("unknown"),
+		sq.QueryVariable("popularity", 1),
+		sq.QueryVariables(map[string]float64{"lat": 1, "unknown": 2}),
+		sq.DocumentVariableFilter("unknown", 0, 1),
+		sq.FunctionFilter("unknown", 0, 1),
+		sq.CategoryFilter(map[string][]string{"color": {"blue"}, "size": {"xl"}}),
+	}
+	for i, err := range failures {
+		if !errors.Is(err, ErrNotInSchema) {
+			t.Errorf("failure %d = %v, want ErrNotInSchema", i, err)
+		}
+	}
+	if after := sq.Query().ToQueryParams(); after != before {
+		t.Errorf("failing calls changed the query from %s to %s", before, after)
+	}
+}
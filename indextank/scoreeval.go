@@ -0,0 +1,192 @@
+package indextank
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Earth radius used by the miles and km functions
+const (
+	earthRadiusMiles = 3958.8
+	earthRadiusKm    = 6371.0
+)
+
+// ScoreEnv holds the values a scoring function is evaluated with. Missing variables are 0.
+type ScoreEnv struct {
+	// Relevance of the document for the query
+	Relevance float64
+	// Age of the document in seconds
+	Age float64
+	// Document variables, doc.var[n]
+	DocVars map[int]float64
+	// Query variables, query.var[n]
+	QueryVars map[int]float64
+}
+
+// EvalScore computes the value of a scoring function for a document, locally, e.g. to preview
+// a function before setting it with Index.AddFunction.
+func EvalScore(e ScoreExpr, env ScoreEnv) (float64, error) {
+	if err := ValidateScoreExpr(e); err != nil {
+		return 0, err
+	}
+	return evalScore(e, &env), nil
+}
+
+// evalScore evaluates a validated expression.
+func evalScore(e ScoreExpr, env *ScoreEnv) float64 {
+	switch x := e.(type) {
+	case *NumberExpr:
+		return x.Value
+	case *RelevanceExpr:
+		return env.Relevance
+	case *AgeExpr:
+		return env.Age
+	case *DocVarExpr:
+		return env.DocVars[x.Index]
+	case *QueryVarExpr:
+		return env.QueryVars[x.Index]
+	case *NegExpr:
+		return -evalScore(x.X, env)
+	case *BinaryExpr:
+		a, b := evalScore(x.X, env), evalScore(x.Y, env)
+		switch x.Op {
+		case '+':
+			return a + b
+		case '-':
+			return a - b
+		case '*':
+			return a * b
+		case '/':
+			return a / b
+		}
+	case *CallExpr:
+		args := make([]float64, len(x.Args))
+		for i, arg := range x.Args {
+			args[i] = evalScore(arg, env)
+		}
+		switch x.Func {
+		case "abs":
+			return math.Abs(args[0])
+		case "log":
+			return math.Log10(args[0])
+		case "ln":
+			return math.Log(args[0])
+		case "sqrt":
+			return math.Sqrt(args[0])
+		case "pow":
+			return math.Pow(args[0], args[1])
+		case "max":
+			return math.Max(args[0], args[1])
+		case "min":
+			return math.Min(args[0], args[1])
+		case "bit":
+			return float64((int64(args[0]) >> uint(args[1])) & 1)
+		case "miles":
+			return earthRadiusMiles * haversine(args[0], args[1], args[2], args[3])
+		case "km":
+			return earthRadiusKm * haversine(args[0], args[1], args[2], args[3])
+		}
+	}
+	panic(fmt.Sprintf("indextank: can't evaluate %T", e))
+}
+
+// haversine returns the central angle in radians between two points given in degrees.
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	const rad = math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// RankCandidate is a document to be ranked by RankDocuments.
+type RankCandidate struct {
+	Docid     string
+	Relevance float64
+	// Age of the document in seconds
+	Age       float64
+	Variables map[int]float64
+}
+
+// RankedDocument is a RankCandidate with its score.
+type RankedDocument struct {
+	RankCandidate
+	Score float64
+}
+
+// RankDocuments scores candidates with a scoring function and the given query variables, and returns
+// them from the highest score to the lowest, keeping the order of candidates with equal scores.
+func RankDocuments(e ScoreExpr, queryVars map[int]float64, candidates []RankCandidate) ([]RankedDocument, error) {
+	if err := ValidateScoreExpr(e); err != nil {
+		return nil, err
+	}
+	ranked := make([]RankedDocument, len(candidates))
+	for i, c := range candidates {
+		env := ScoreEnv{Relevance: c.Relevance, Age: c.Age, DocVars: c.Variables, QueryVars: queryVars}
+		ranked[i] = RankedDocument{c, evalScore(e, &env)}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Score > ranked[j].Score
+	})
+	return ranked, nil
+}
+
+// CandidatesFromHits turns the hits of captured SearchResults into ranking candidates, to preview how
+// another scoring function would reorder them. Their variables are the ones fetched with
+// Query.FetchVariables, and their age is computed relative to now from a fetched "timestamp" field
+// (seconds since the epoch), or 0 if there is none.
+//
+// The score of a hit is the value of the scoring function of the search, which is the text relevance
+// only if that function is "relevance". relevance returns the relevance of each hit: ScoreAsRelevance
+// for hits of such a search, or a function looking it up elsewhere. If relevance is nil, it is 0, which
+// is fine for functions that don't use it.
+func CandidatesFromHits(hits []Hit, relevance func(Hit) float64, now time.Time) []RankCandidate {
+	candidates := make([]RankCandidate, len(hits))
+	for i, hit := range hits {
+		candidates[i] = RankCandidate{
+			Docid:     hit.Docid,
+			Age:       ageOf(hit.Fields, now),
+			Variables: hit.Variables,
+		}
+		if relevance != nil {
+			candidates[i].Relevance = relevance(hit)
+		}
+	}
+	return candidates
+}
+
+// ScoreAsRelevance returns the score of a hit, for CandidatesFromHits with the hits of a search whose
+// scoring function is "relevance", e.g. one with Query.ScoringFunction(n) for a function n defined as
+// "relevance".
+func ScoreAsRelevance(hit Hit) float64 {
+	return hit.Score
+}
+
+// CandidateFromDocument turns a Document into a ranking candidate with the given relevance. Its age
+// is computed relative to now from its "timestamp" field, or 0 if it has none.
+func CandidateFromDocument(doc Document, relevance float64, now time.Time) RankCandidate {
+	vars := make(map[int]float64, len(doc.Variables))
+	for k, v := range doc.Variables {
+		if n, err := strconv.Atoi(k); err == nil {
+			vars[n] = float64(v)
+		}
+	}
+	return RankCandidate{
+		Docid:     doc.Id,
+		Relevance: relevance,
+		Age:       ageOf(doc.Fields, now),
+		Variables: vars,
+	}
+}
+
+func ageOf(fields map[string]string, now time.Time) float64 {
+	ts, err := strconv.ParseFloat(fields["timestamp"], 64)
+	if err != nil {
+		return 0
+	}
+	return float64(now.Unix()) - ts
+}
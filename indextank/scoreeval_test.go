@@ -0,0 +1,131 @@
+package indextank
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEvalScore(t *testing.T) {
+	env := ScoreEnv{
+		Relevance: 2,
+		Age:       3600,
+		DocVars:   map[int]float64{0: 100, 1: 5, 2: 30.27, 3: -97.74},
+		QueryVars: map[int]float64{0: 0.5, 1: 30.27, 2: -97.74},
+	}
+	tests := []struct {
+		definition string
+		want       float64
+	}{
+		{"relevance", 2},
+		{"-age", -3600},
+		{"doc.var[0] + d[1]", 105},
+		{"query.var[0] * q[0]", 0.25},
+		{"doc.var[9]", 0},
+		{"relevance * log(doc.var[0])", 4},
+		{"ln(1)", 0},
+		{"sqrt(d[0]) - abs(-1)", 9},
+		{"pow(2, 10) / 4", 256},
+		{"max(d[0], d[1]) - min(d[0], d[1])", 95},
+		{"bit(d[1], 0) + bit(d[1], 1)", 1},
+		{"-(1 - 2) * 3", 3},
+		{"miles(q[1], q[2], d[2], d[3])", 0},
+		{"km(0, 0, 0, 1)", 2 * math.Pi * earthRadiusKm / 360},
+	}
+	for _, test := range tests {
+		e, err := ParseScoreFunction(test.definition)
+		if err != nil {
+			t.Errorf("ParseScoreFunction(%q): %v", test.definition, err)
+			continue
+		}
+		got, err := EvalScore(e, env)
+		if err != nil {
+			t.Errorf("EvalScore(%q): %v", test.definition, err)
+			continue
+		}
+		if math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("EvalScore(%q) = %v, want %v", test.definition, got, test.want)
+		}
+	}
+}
+
+func TestEvalScoreInvalid(t *testing.T) {
+	for _, e := range []ScoreExpr{
+		DocVar(-1),
+		Num(math.NaN()),
+		&CallExpr{"log", nil},
+		&CallExpr{"nope", []ScoreExpr{Num(1)}},
+		Bit(DocVar(0), -1),
+		nil,
+	} {
+		if _, err := EvalScore(e, ScoreEnv{}); err == nil {
+			t.Errorf("EvalScore(%v) accepted an invalid expression", e)
+		}
+	}
+}
+
+func TestRankDocuments(t *testing.T) {
+	candidates := []RankCandidate{
+		{Docid: "a", Relevance: 1, Variables: map[int]float64{0: 10}},
+		{Docid: "b", Relevance: 3, Variables: map[int]float64{0: 1}},
+		{Docid: "c", Relevance: 2, Variables: map[int]float64{0: 10}},
+	}
+	tests := []struct {
+		definition string
+		want       []string
+	}{
+		{"relevance", []string{"b", "c", "a"}},
+		{"doc.var[0]", []string{"a", "c", "b"}},
+		{"0", []string{"a", "b", "c"}},
+	}
+	for _, test := range tests {
+		ranked, err := RankDocuments(mustParseScore(t, test.definition), nil, candidates)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range ranked {
+			got = append(got, r.Docid)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("RankDocuments(%q) = %v, want %v", test.definition, got, test.want)
+		}
+	}
+}
+
+func TestCandidatesFromHits(t *testing.T) {
+	now := time.Unix(10000, 0)
+	hits := []Hit{
+		{Docid: "a", Score: 7, Fields: map[string]string{"timestamp": "9000"}, Variables: map[int]float64{0: 1}},
+		{Docid: "b", Score: 9},
+	}
+
+	candidates := CandidatesFromHits(hits, nil, now)
+	if candidates[0].Relevance != 0 || candidates[0].Age != 1000 || candidates[0].Variables[0] != 1 {
+		t.Errorf("without relevance: got %+v", candidates[0])
+	}
+	if candidates[1].Age != 0 {
+		t.Errorf("without timestamp: got age %v, want 0", candidates[1].Age)
+	}
+
+	candidates = CandidatesFromHits(hits, ScoreAsRelevance, now)
+	if candidates[0].Relevance != 7 || candidates[1].Relevance != 9 {
+		t.Errorf("with ScoreAsRelevance: got %+v", candidates)
+	}
+
+	relevance := map[string]float64{"a": 0.5, "b": 0.25}
+	candidates = CandidatesFromHits(hits, func(h Hit) float64 { return relevance[h.Docid] }, now)
+	if candidates[0].Relevance != 0.5 || candidates[1].Relevance != 0.25 {
+		t.Errorf("with a lookup: got %+v", candidates)
+	}
+}
+
+func mustParseScore(t *testing.T, definition string) ScoreExpr {
+	t.Helper()
+	e, err := ParseScoreFunction(definition)
+	if err != nil {
+		t.Fatalf("ParseScoreFunction(%q): %v", definition, err)
+	}
+	return e
+}
@@ -0,0 +1,524 @@
+package indextank
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ScoreExpr is a node of a scoring function expression, as set with Index.AddFunction. Build one with
+// Num, Relevance, Age, DocVar, QueryVar, the arithmetic helpers Add, Sub, Mul, Div and Neg and the
+// function helpers Abs, Log, Ln, Sqrt, Pow, Max, Min, Bit, Miles and Km, or parse one with
+// ParseScoreFunction. String renders the expression in canonical form:
+//
+//	// log(doc.var[0]) - age / 86400
+//	f := indextank.Sub(indextank.Log(indextank.DocVar(0)), indextank.Div(indextank.Age(), indextank.Num(86400)))
+//	if err := indextank.ValidateScoreExpr(f); err != nil { ... }
+//	err := idx.AddFunction(1, f.String())
+type ScoreExpr interface {
+	String() string
+	// precedence of the expression, to decide where parentheses are needed
+	scorePrecedence() int
+}
+
+const (
+	scorePrecSum = iota + 1
+	scorePrecProduct
+	scorePrecUnary
+	scorePrecAtom
+)
+
+// NumberExpr is a numeric constant.
+type NumberExpr struct {
+	Value float64
+}
+
+// RelevanceExpr is the relevance of the document for the query (also written rel or _score).
+type RelevanceExpr struct{}
+
+// AgeExpr is the age of the document in seconds, based on its timestamp.
+type AgeExpr struct{}
+
+// DocVarExpr is a document variable, doc.var[Index] (also written d[Index]).
+type DocVarExpr struct {
+	Index int
+}
+
+// QueryVarExpr is a query variable, query.var[Index] (also written q[Index]), set with Query.QueryVariable.
+type QueryVarExpr struct {
+	Index int
+}
+
+// NegExpr negates an expression.
+type NegExpr struct {
+	X ScoreExpr
+}
+
+// BinaryExpr is an arithmetic operation: Op is one of '+', '-', '*' and '/'.
+type BinaryExpr struct {
+	Op   byte
+	X, Y ScoreExpr
+}
+
+// CallExpr is a call of one of the scoring functions, e.g. log(doc.var[0]).
+type CallExpr struct {
+	Func string
+	Args []ScoreExpr
+}
+
+// scoreFunctions maps the functions available in scoring functions to their number of arguments.
+var scoreFunctions = map[string]int{
+	"abs":   1,
+	"log":   1,
+	"ln":    1,
+	"sqrt":  1,
+	"pow":   2,
+	"max":   2,
+	"min":   2,
+	"bit":   2,
+	"miles": 4,
+	"km":    4,
+}
+
+// Num returns a numeric constant.
+func Num(value float64) ScoreExpr { return &NumberExpr{value} }
+
+// Relevance returns the relevance of the document for the query.
+func Relevance() ScoreExpr { return &RelevanceExpr{} }
+
+// Age returns the age of the document in seconds.
+func Age() ScoreExpr { return &AgeExpr{} }
+
+// DocVar returns the document variable with the given index.
+func DocVar(index int) ScoreExpr { return &DocVarExpr{index} }
+
+// QueryVar returns the query variable with the given index.
+func QueryVar(index int) ScoreExpr { return &QueryVarExpr{index} }
+
+// Add returns x + y.
+func Add(x, y ScoreExpr) ScoreExpr { return &BinaryExpr{'+', x, y} }
+
+// Sub returns x - y.
+func Sub(x, y ScoreExpr) ScoreExpr { return &BinaryExpr{'-', x, y} }
+
+// Mul returns x * y.
+func Mul(x, y ScoreExpr) ScoreExpr { return &BinaryExpr{'*', x, y} }
+
+// Div returns x / y.
+func Div(x, y ScoreExpr) ScoreExpr { return &BinaryExpr{'/', x, y} }
+
+// Neg returns -x.
+func Neg(x ScoreExpr) ScoreExpr { return &NegExpr{x} }
+
+// Abs returns abs(x).
+func Abs(x ScoreExpr) ScoreExpr { return &CallExpr{"abs", []ScoreExpr{x}} }
+
+// Log returns log(x), the base 10 logarithm of x.
+func Log(x ScoreExpr) ScoreExpr { return &CallExpr{"log", []ScoreExpr{x}} }
+
+// Ln returns ln(x), the natural logarithm of x.
+func Ln(x ScoreExpr) ScoreExpr { return &CallExpr{"ln", []ScoreExpr{x}} }
+
+// Sqrt returns sqrt(x).
+func Sqrt(x ScoreExpr) ScoreExpr { return &CallExpr{"sqrt", []ScoreExpr{x}} }
+
+// Pow returns pow(x, y), x to the power of y.
+func Pow(x, y ScoreExpr) ScoreExpr { return &CallExpr{"pow", []ScoreExpr{x, y}} }
+
+// Max returns max(x, y).
+func Max(x, y ScoreExpr) ScoreExpr { return &CallExpr{"max", []ScoreExpr{x, y}} }
+
+// Min returns min(x, y).
+func Min(x, y ScoreExpr) ScoreExpr { return &CallExpr{"min", []ScoreExpr{x, y}} }
+
+// Bit returns bit(x, n), the n-th bit of the integer part of x.
+func Bit(x ScoreExpr, n int) ScoreExpr { return &CallExpr{"bit", []ScoreExpr{x, Num(float64(n))}} }
+
+// Miles returns the distance in miles between two points given by their latitude and longitude in degrees.
+func Miles(lat1, lon1, lat2, lon2 ScoreExpr) ScoreExpr {
+	return &CallExpr{"miles", []ScoreExpr{lat1, lon1, lat2, lon2}}
+}
+
+// Km returns the distance in kilometers between two points given by their latitude and longitude in degrees.
+func Km(lat1, lon1, lat2, lon2 ScoreExpr) ScoreExpr {
+	return &CallExpr{"km", []ScoreExpr{lat1, lon1, lat2, lon2}}
+}
+
+func (e *NumberExpr) String() string {
+	return strconv.FormatFloat(e.Value, 'g', -1, 64)
+}
+
+func (e *RelevanceExpr) String() string { return "relevance" }
+func (e *AgeExpr) String() string       { return "age" }
+func (e *DocVarExpr) String() string    { return "doc.var[" + strconv.Itoa(e.Index) + "]" }
+func (e *QueryVarExpr) String() string  { return "query.var[" + strconv.Itoa(e.Index) + "]" }
+
+func (e *NegExpr) String() string {
+	return "-" + scoreGroup(e.X, scorePrecUnary)
+}
+
+func (e *BinaryExpr) String() string {
+	prec := e.scorePrecedence()
+	// operations are left associative, so a - (b - c) keeps its parentheses
+	right := prec
+	if e.Op == '-' || e.Op == '/' {
+		right++
+	}
+	return scoreGroup(e.X, prec) + " " + string(e.Op) + " " + scoreGroup(e.Y, right)
+}
+
+func (e *CallExpr) String() string {
+	args := make([]string, len(e.Args))
+	for i, arg := range e.Args {
+		args[i] = arg.String()
+	}
+	return e.Func + "(" + strings.Join(args, ", ") + ")"
+}
+
+func (e *NumberExpr) scorePrecedence() int {
+	if e.Value < 0 {
+		return scorePrecUnary
+	}
+	return scorePrecAtom
+}
+func (e *RelevanceExpr) scorePrecedence() int { return scorePrecAtom }
+func (e *AgeExpr) scorePrecedence() int       { return scorePrecAtom }
+func (e *DocVarExpr) scorePrecedence() int    { return scorePrecAtom }
+func (e *QueryVarExpr) scorePrecedence() int  { return scorePrecAtom }
+func (e *NegExpr) scorePrecedence() int       { return scorePrecUnary }
+func (e *CallExpr) scorePrecedence() int      { return scorePrecAtom }
+func (e *BinaryExpr) scorePrecedence() int {
+	if e.Op == '*' || e.Op == '/' {
+		return scorePrecProduct
+	}
+	return scorePrecSum
+}
+
+func scoreGroup(e ScoreExpr, prec int) string {
+	if e.scorePrecedence() < prec {
+		return "(" + e.String() + ")"
+	}
+	return e.String()
+}
+
+// ValidateScoreExpr checks that a scoring function expression is well formed: known functions called
+// with the right number of arguments, non-negative variable indexes, finite constants and, for bit,
+// a constant non-negative integer bit number.
+func ValidateScoreExpr(e ScoreExpr) error {
+	switch x := e.(type) {
+	case *NumberExpr:
+		if math.IsNaN(x.Value) || math.IsInf(x.Value, 0) {
+			return fmt.Errorf("invalid constant %v in scoring function", x.Value)
+		}
+	case *RelevanceExpr, *AgeExpr:
+	case *DocVarExpr:
+		if x.Index < 0 {
+			return fmt.Errorf("invalid document variable index %d", x.Index)
+		}
+	case *QueryVarExpr:
+		if x.Index < 0 {
+			return fmt.Errorf("invalid query variable index %d", x.Index)
+		}
+	case *NegExpr:
+		return ValidateScoreExpr(x.X)
+	case *BinaryExpr:
+		if !strings.ContainsRune("+-*/", rune(x.Op)) {
+			return fmt.Errorf("invalid operator %q in scoring function", x.Op)
+		}
+		if err := ValidateScoreExpr(x.X); err != nil {
+			return err
+		}
+		return ValidateScoreExpr(x.Y)
+	case *CallExpr:
+		if err := validateCall(x); err != nil {
+			return err
+		}
+		for _, arg := range x.Args {
+			if err := ValidateScoreExpr(arg); err != nil {
+				return err
+			}
+		}
+	case nil:
+		return fmt.Errorf("missing expression in scoring function")
+	default:
+		return fmt.Errorf("unsupported expression %T in scoring function", e)
+	}
+	return nil
+}
+
+// validateCall checks the function and arguments of a call, but not the arguments themselves.
+func validateCall(x *CallExpr) error {
+	arity, ok := scoreFunctions[x.Func]
+	if !ok {
+		return fmt.Errorf("unknown function %s in scoring function", x.Func)
+	}
+	if len(x.Args) != arity {
+		return fmt.Errorf("function %s takes %d arguments, not %d", x.Func, arity, len(x.Args))
+	}
+	if x.Func == "bit" {
+		n, ok := x.Args[1].(*NumberExpr)
+		if !ok || n.Value < 0 || n.Value != math.Trunc(n.Value) {
+			return fmt.Errorf("the second argument of bit must be a non-negative integer constant")
+		}
+	}
+	return nil
+}
+
+// ScoreFunctionError describes an invalid scoring function definition, as returned by ParseScoreFunction.
+type ScoreFunctionError struct {
+	// Byte offset in the definition where the problem was found
+	Pos     int
+	Message string
+}
+
+func (e *ScoreFunctionError) Error() string {
+	return fmt.Sprintf("scoring function error at position %d: %s", e.Pos, e.Message)
+}
+
+// ParseScoreFunction parses a scoring function definition, e.g. "-age" or
+// "relevance * log(doc.var[0]) - miles(query.var[0], query.var[1], d[1], d[2])". The expressions
+// it returns pass ValidateScoreExpr: function calls are checked as they are parsed, so errors
+// point at the call.
+func ParseScoreFunction(definition string) (ScoreExpr, error) {
+	p := &scoreParser{s: definition}
+	p.skipSpace()
+	if p.pos == len(p.s) {
+		return nil, &ScoreFunctionError{0, "empty definition"}
+	}
+	e, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:p.pos+1])
+	}
+	return e, nil
+}
+
+// ParseFunctions parses the scoring functions returned by Index.ListFunctions, keyed by function number.
+func ParseFunctions(functions map[string]string) (map[int]ScoreExpr, error) {
+	keys := make([]string, 0, len(functions))
+	for k := range functions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parsed := make(map[int]ScoreExpr, len(functions))
+	for _, k := range keys {
+		n, err := strconv.Atoi(k)
+		if err != nil {
+			return nil, fmt.Errorf("invalid function number %q", k)
+		}
+		e, err := ParseScoreFunction(functions[k])
+		if err != nil {
+			return nil, fmt.Errorf("function %d: %v", n, err)
+		}
+		parsed[n] = e
+	}
+	return parsed, nil
+}
+
+type scoreParser struct {
+	s   string
+	pos int
+}
+
+func (p *scoreParser) errorf(format string, args ...interface{}) error {
+	return &ScoreFunctionError{p.pos, fmt.Sprintf(format, args...)}
+}
+
+func (p *scoreParser) skipSpace() {
+	for p.pos < len(p.s) && isSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space byte, or 0 at the end.
+func (p *scoreParser) peek() byte {
+	p.skipSpace()
+	if p.pos == len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+// sum := product (("+" | "-") product)*
+func (p *scoreParser) parseSum() (ScoreExpr, error) {
+	x, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return x, nil
+		}
+		p.pos++
+		y, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		x = &BinaryExpr{op, x, y}
+	}
+}
+
+// product := unary (("*" | "/") unary)*
+func (p *scoreParser) parseProduct() (ScoreExpr, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return x, nil
+		}
+		p.pos++
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		x = &BinaryExpr{op, x, y}
+	}
+}
+
+// unary := ("-" | "+") unary | primary
+func (p *scoreParser) parseUnary() (ScoreExpr, error) {
+	switch p.peek() {
+	case '-':
+		p.pos++
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if n, ok := x.(*NumberExpr); ok {
+			return &NumberExpr{-n.Value}, nil
+		}
+		return &NegExpr{x}, nil
+	case '+':
+		p.pos++
+		return p.parseUnary()
+	}
+	return p.parsePrimary()
+}
+
+// primary := number | "(" sum ")" | name | name "[" int "]" | name "(" args ")"
+func (p *scoreParser) parsePrimary() (ScoreExpr, error) {
+	c := p.peek()
+	start := p.pos
+	switch {
+	case c == 0:
+		return nil, p.errorf("unexpected end of definition")
+	case c == '(':
+		p.pos++
+		e, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, &ScoreFunctionError{start, "unbalanced '('"}
+		}
+		p.pos++
+		return e, nil
+	case c == '.' || (c >= '0' && c <= '9'):
+		for p.pos < len(p.s) && (p.s[p.pos] == '.' || p.s[p.pos] >= '0' && p.s[p.pos] <= '9' ||
+			p.s[p.pos] == 'e' || p.s[p.pos] == 'E' ||
+			(p.s[p.pos] == '-' || p.s[p.pos] == '+') && (p.s[p.pos-1] == 'e' || p.s[p.pos-1] == 'E')) {
+			p.pos++
+		}
+		f, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+		if err != nil {
+			return nil, &ScoreFunctionError{start, "invalid number " + p.s[start:p.pos]}
+		}
+		return &NumberExpr{f}, nil
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for p.pos < len(p.s) && (p.s[p.pos] == '_' || p.s[p.pos] == '.' || unicode.IsLetter(rune(p.s[p.pos])) ||
+			p.s[p.pos] >= '0' && p.s[p.pos] <= '9') {
+			p.pos++
+		}
+		name := p.s[start:p.pos]
+		switch name {
+		case "relevance", "rel", "_score":
+			return &RelevanceExpr{}, nil
+		case "age", "doc.age":
+			return &AgeExpr{}, nil
+		case "doc.var", "d", "query.var", "q":
+			n, err := p.parseIndex()
+			if err != nil {
+				return nil, err
+			}
+			if name == "doc.var" || name == "d" {
+				return &DocVarExpr{n}, nil
+			}
+			return &QueryVarExpr{n}, nil
+		}
+		if _, ok := scoreFunctions[name]; !ok {
+			return nil, &ScoreFunctionError{start, "unknown name " + name}
+		}
+		args, err := p.parseArgs()
+		if err != nil {
+			return nil, err
+		}
+		call := &CallExpr{name, args}
+		if err := validateCall(call); err != nil {
+			return nil, &ScoreFunctionError{start, err.Error()}
+		}
+		return call, nil
+	}
+	return nil, p.errorf("unexpected %q", string(c))
+}
+
+// parseIndex parses "[" int "]".
+func (p *scoreParser) parseIndex() (int, error) {
+	if p.peek() != '[' {
+		return 0, p.errorf("expected '['")
+	}
+	p.pos++
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+	n, err := strconv.Atoi(p.s[start:p.pos])
+	if err != nil {
+		return 0, &ScoreFunctionError{start, "variable index must be a non-negative integer"}
+	}
+	if p.peek() != ']' {
+		return 0, p.errorf("expected ']'")
+	}
+	p.pos++
+	return n, nil
+}
+
+// parseArgs parses "(" sum ("," sum)* ")".
+func (p *scoreParser) parseArgs() ([]ScoreExpr, error) {
+	if p.peek() != '(' {
+		return nil, p.errorf("expected '('")
+	}
+	p.pos++
+	var args []ScoreExpr
+	if p.peek() == ')' {
+		p.pos++
+		return args, nil
+	}
+	for {
+		arg, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ')':
+			p.pos++
+			return args, nil
+		default:
+			return nil, p.errorf("expected ',' or ')'")
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package indextank
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseScoreFunction(t *testing.T) {
+	tests := []struct {
+		definition, want string
+	}{
+		{`-age`, `-age`},
+		{`doc.age`, `age`},
+		{`rel + _score`, `relevance + relevance`},
+		{`relevance * log(doc.var[0]) - miles(query.var[0], query.var[1], d[1], d[2])`,
+			`relevance * log(doc.var[0]) - miles(query.var[0], query.var[1], doc.var[1], doc.var[2])`},
+		{`q[2] / (d[1] * 2)`, `query.var[2] / (doc.var[1] * 2)`},
+		{`1 - (2 - 3)`, `1 - (2 - 3)`},
+		{`(1 - 2) - 3`, `1 - 2 - 3`},
+		{`2 * (3 + 4)`, `2 * (3 + 4)`},
+		{`-d[0]`, `-doc.var[0]`},
+		{`- -1`, `1`},
+		{`+5`, `5`},
+		{`1.5e3`, `1500`},
+		{`.5`, `0.5`},
+		{` 1 `, `1`},
+		{`bit(d[0], 3)`, `bit(doc.var[0], 3)`},
+		{`max(1, min(2, 3))`, `max(1, min(2, 3))`},
+	}
+	for _, test := range tests {
+		e, err := ParseScoreFunction(test.definition)
+		if err != nil {
+			t.Errorf("ParseScoreFunction(%q): %v", test.definition, err)
+			continue
+		}
+		if got := e.String(); got != test.want {
+			t.Errorf("ParseScoreFunction(%q) = %q, want %q", test.definition, got, test.want)
+		}
+		if err := ValidateScoreExpr(e); err != nil {
+			t.Errorf("ParseScoreFunction(%q) returned an invalid expression: %v", test.definition, err)
+		}
+		// the rendered form parses back to itself
+		again, err := ParseScoreFunction(test.want)
+		if err != nil || again.String() != test.want {
+			t.Errorf("ParseScoreFunction(%q) = %v, %v, want it unchanged", test.want, again, err)
+		}
+	}
+}
+
+func TestParseScoreFunctionErrors(t *testing.T) {
+	tests := []struct {
+		definition string
+		pos        int
+	}{
+		{``, 0},
+		{`   `, 0},
+		{`foo`, 0},
+		{`-(a)`, 2},
+		{`log(1, 2)`, 0},
+		{`log(sqrt(1, 2))`, 4},
+		{`abs()`, 0},
+		{`bit(d[0], -1)`, 0},
+		{`bit(d[0], 1.5)`, 0},
+		{`bit(d[0], d[1])`, 0},
+		{`max(1`, 5},
+		{`(1 + 2`, 0},
+		{`d[x]`, 2},
+		{`d[1`, 3},
+		{`d 1`, 2},
+		{`1 +`, 3},
+		{`1 2`, 2},
+		{`1e999`, 0},
+	}
+	for _, test := range tests {
+		_, err := ParseScoreFunction(test.definition)
+		var se *ScoreFunctionError
+		if !errors.As(err, &se) {
+			t.Errorf("ParseScoreFunction(%q) = %v, want a ScoreFunctionError", test.definition, err)
+		} else if se.Pos != test.pos {
+			t.Errorf("ParseScoreFunction(%q) error at %d (%v), want %d", test.definition, se.Pos, err, test.pos)
+		}
+	}
+}
+
+func TestValidateScoreExpr(t *testing.T) {
+	valid := []ScoreExpr{
+		Relevance(),
+		Neg(Age()),
+		Add(Mul(Relevance(), Log(DocVar(0))), Div(Age(), Num(86400))),
+		Km(QueryVar(0), QueryVar(1), DocVar(1), DocVar(2)),
+		Bit(DocVar(3), 2),
+		Pow(Max(DocVar(0), Num(1)), Min(Sqrt(Abs(DocVar(1))), Ln(Num(2)))),
+	}
+	for _, e := range valid {
+		if err := ValidateScoreExpr(e); err != nil {
+			t.Errorf("ValidateScoreExpr(%v): %v", e, err)
+		}
+	}
+
+	invalid := []ScoreExpr{
+		nil,
+		Num(math.Inf(1)),
+		Num(math.NaN()),
+		DocVar(-1),
+		QueryVar(-2),
+		Neg(DocVar(-1)),
+		Add(Num(1), nil),
+		&BinaryExpr{'%', Num(1), Num(2)},
+		&CallExpr{"exp", []ScoreExpr{Num(1)}},
+		&CallExpr{"max", []ScoreExpr{Num(1)}},
+		Log(DocVar(-1)),
+		Bit(DocVar(0), -1),
+		&CallExpr{"bit", []ScoreExpr{DocVar(0), DocVar(1)}},
+	}
+	for _, e := range invalid {
+		if err := ValidateScoreExpr(e); err == nil {
+			t.Errorf("ValidateScoreExpr(%#v) accepted an invalid expression", e)
+		}
+	}
+}
+
+func TestParseFunctions(t *testing.T) {
+	parsed, err := ParseFunctions(map[string]string{"0": "-age", "2": "relevance * d[0]"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 2 || parsed[0].String() != "-age" || parsed[2].String() != "relevance * doc.var[0]" {
+		t.Errorf("ParseFunctions = %v", parsed)
+	}
+	if _, err := ParseFunctions(map[string]string{"x": "age"}); err == nil {
+		t.Error("ParseFunctions accepted a non-numeric function number")
+	}
+	if _, err := ParseFunctions(map[string]string{"1": "age +"}); err == nil {
+		t.Error("ParseFunctions accepted an invalid definition")
+	}
+}
@@ -0,0 +1,389 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/searchify/gotank/indextank"
+)
+
+const indexesPath = "/v1/indexes/"
+
+// handle serves a request like the IndexTank API would.
+func (s *Server) handle(w http.ResponseWriter, r *http.Request, name, sub string, body []byte) {
+	if name == "" {
+		if r.Method != "GET" {
+			methodNotAllowed(w)
+			return
+		}
+		s.listIndexes(w)
+		return
+	}
+	if sub == "" {
+		s.handleIndex(w, r, name, body)
+		return
+	}
+	idx := s.Index(name)
+	if idx == nil {
+		http.Error(w, "No index existed for the given name", http.StatusNotFound)
+		return
+	}
+	switch {
+	case sub == "/docs":
+		handleDocs(w, r, idx, body)
+	case sub == "/docs/variables":
+		handleVariables(w, r, idx, body)
+	case sub == "/docs/categories":
+		handleCategories(w, r, idx, body)
+	case sub == "/functions":
+		handleFunctions(w, r, idx)
+	case strings.HasPrefix(sub, "/functions/"):
+		handleFunction(w, r, idx, sub[len("/functions/"):], body)
+	case sub == "/search":
+		handleSearch(w, r, idx)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) listIndexes(w http.ResponseWriter) {
+	s.mu.Lock()
+	indexes := make(map[string]*indextank.MemoryIndex, len(s.indexes))
+	for k, v := range s.indexes {
+		indexes[k] = v
+	}
+	s.mu.Unlock()
+
+	list := map[string]interface{}{}
+	for name, idx := range indexes {
+		if metadata, err := idx.GetMetadata(); err == nil {
+			list[name] = metadata
+		}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request, name string, body []byte) {
+	switch r.Method {
+	case "GET":
+		idx := s.Index(name)
+		if idx == nil {
+			http.Error(w, "No index existed for the given name", http.StatusNotFound)
+			return
+		}
+		writeMetadata(w, http.StatusOK, idx)
+	case "PUT":
+		options := map[string]interface{}{}
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &options); err != nil {
+				http.Error(w, "Invalid index options: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		s.mu.Lock()
+		idx, exists := s.indexes[name]
+		if !exists {
+			idx = indextank.NewMemoryIndex()
+		}
+		if err := idx.UpdateIndex(options); err != nil {
+			s.mu.Unlock()
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.indexes[name] = idx
+		s.mu.Unlock()
+		if exists {
+			// an existing index gets its options updated
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeMetadata(w, http.StatusCreated, idx)
+	case "DELETE":
+		s.mu.Lock()
+		_, exists := s.indexes[name]
+		delete(s.indexes, name)
+		s.mu.Unlock()
+		if !exists {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func writeMetadata(w http.ResponseWriter, status int, idx *indextank.MemoryIndex) {
+	metadata, err := idx.GetMetadata()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, status, metadata)
+}
+
+func handleDocs(w http.ResponseWriter, r *http.Request, idx *indextank.MemoryIndex, body []byte) {
+	switch r.Method {
+	case "PUT":
+		if !isBatch(body) {
+			var doc indextank.Document
+			if err := json.Unmarshal(body, &doc); err != nil {
+				http.Error(w, "Invalid document: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			results, err := idx.AddDocuments([]indextank.Document{doc})
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			if msg, ok := results.GetErrorMessage(0); ok {
+				http.Error(w, msg, http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		var docs []indextank.Document
+		if err := json.Unmarshal(body, &docs); err != nil {
+			http.Error(w, "Invalid documents: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		results, err := idx.AddDocuments(docs)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		list := make([]map[string]interface{}, len(docs))
+		for i := range docs {
+			msg, _ := results.GetErrorMessage(i)
+			list[i] = batchResult("added", results.GetResult(i), msg)
+		}
+		writeJSON(w, http.StatusOK, list)
+	case "DELETE":
+		if !isBatch(body) {
+			docid := r.URL.Query().Get("docid")
+			if docid == "" {
+				http.Error(w, "Invalid or missing argument: docid", http.StatusBadRequest)
+				return
+			}
+			if err := idx.DeleteDocument(docid); err != nil {
+				writeError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		var docs []struct {
+			Docid string `json:"docid"`
+		}
+		if err := json.Unmarshal(body, &docs); err != nil {
+			http.Error(w, "Invalid document ids: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		docids := make([]string, len(docs))
+		for i, doc := range docs {
+			docids[i] = doc.Docid
+		}
+		results, err := idx.DeleteDocuments(docids)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		list := make([]map[string]interface{}, len(docs))
+		for i := range docs {
+			msg, _ := results.GetErrorMessage(i)
+			list[i] = batchResult("deleted", results.GetResult(i), msg)
+		}
+		writeJSON(w, http.StatusOK, list)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+// batchResult returns the result of one element of a batch call, e.g. {"added":false, "error":"..."}.
+func batchResult(key string, ok bool, msg string) map[string]interface{} {
+	if !ok {
+		return map[string]interface{}{key: false, "error": msg}
+	}
+	return map[string]interface{}{key: true}
+}
+
+func handleVariables(w http.ResponseWriter, r *http.Request, idx *indextank.MemoryIndex, body []byte) {
+	if r.Method != "PUT" {
+		methodNotAllowed(w)
+		return
+	}
+	var update struct {
+		Docid     string             `json:"docid"`
+		Variables map[string]float32 `json:"variables"`
+	}
+	if err := json.Unmarshal(body, &update); err != nil {
+		http.Error(w, "Invalid variables: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	variables := map[int]float32{}
+	for k, v := range update.Variables {
+		n, err := strconv.Atoi(k)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid variable index %q", k), http.StatusBadRequest)
+			return
+		}
+		variables[n] = v
+	}
+	if err := idx.UpdateVariables(update.Docid, variables); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func handleCategories(w http.ResponseWriter, r *http.Request, idx *indextank.MemoryIndex, body []byte) {
+	if r.Method != "PUT" {
+		methodNotAllowed(w)
+		return
+	}
+	if !isBatch(body) {
+		var update indextank.CategoryUpdate
+		if err := json.Unmarshal(body, &update); err != nil {
+			http.Error(w, "Invalid categories: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := idx.UpdateCategories(update.Id, update.Categories); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var updates []indextank.CategoryUpdate
+	if err := json.Unmarshal(body, &updates); err != nil {
+		http.Error(w, "Invalid categories: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	results, err := idx.UpdateCategoriesBatch(updates)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	list := make([]map[string]interface{}, len(updates))
+	for i := range updates {
+		msg, _ := results.GetErrorMessage(i)
+		list[i] = batchResult("updated", results.GetResult(i), msg)
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func handleFunctions(w http.ResponseWriter, r *http.Request, idx *indextank.MemoryIndex) {
+	if r.Method != "GET" {
+		methodNotAllowed(w)
+		return
+	}
+	functions, err := idx.ListFunctions()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, functions)
+}
+
+func handleFunction(w http.ResponseWriter, r *http.Request, idx *indextank.MemoryIndex, num string, body []byte) {
+	n, err := strconv.Atoi(num)
+	if err != nil || n < 0 {
+		http.Error(w, "Invalid function index "+num, http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case "PUT":
+		var function struct {
+			Definition string `json:"definition"`
+		}
+		if err := json.Unmarshal(body, &function); err != nil {
+			http.Error(w, "Invalid function: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = idx.AddFunction(n, function.Definition)
+	case "DELETE":
+		err = idx.DeleteFunction(n)
+	default:
+		methodNotAllowed(w)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func handleSearch(w http.ResponseWriter, r *http.Request, idx *indextank.MemoryIndex) {
+	query, err := parseQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	switch r.Method {
+	case "GET":
+		results, err := idx.SearchWithQuery(query)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"matches":     results.GetMatches(),
+			"query":       results.GetQuery(),
+			"search_time": strconv.FormatFloat(float64(results.GetSearchTime()), 'f', 3, 32),
+			"facets":      results.GetFacets(),
+			"results":     results.GetResults(),
+			"didyoumean":  nil,
+		})
+	case "DELETE":
+		deleted, err := idx.DeleteBySearch(query)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"deleted": deleted})
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+// parseQuery builds a Query from the parameters of a search request.
+func parseQuery(values url.Values) (indextank.Query, error) {
+	if _, ok := values["q"]; !ok {
+		return nil, fmt.Errorf("%w: missing argument q", indextank.ErrInvalidQuery)
+	}
+	return indextank.ParseQueryParams(values.Encode())
+}
+
+// writeError responds with the status the API uses for an error of a MemoryIndex.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, indextank.ErrIndexNotFound) {
+		status = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func methodNotAllowed(w http.ResponseWriter) {
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,229 @@
+// Package server serves the IndexTank v1 REST API used by the indextank package, so that
+// indextank.NewApiClient works against a local server. Each index is kept in an
+// indextank.MemoryIndex, and is optionally saved to a directory after every change.
+//
+// The server has no authentication: the password in the API URL is ignored. Searches behave
+// as documented for indextank.MemoryIndex.
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/searchify/gotank/indextank"
+)
+
+// file name extension of saved indexes
+const indexFileExt = ".json"
+
+// Server is an http.Handler serving the IndexTank v1 REST API.
+type Server struct {
+	mu      sync.Mutex
+	indexes map[string]*indextank.MemoryIndex
+	// directory the indexes are saved to, or "" to keep them in memory only
+	dir    string
+	saveMu sync.Mutex
+}
+
+// New returns a Server with no indexes, which keeps them in memory only.
+func New() *Server {
+	return &Server{indexes: map[string]*indextank.MemoryIndex{}}
+}
+
+// Open returns a Server with the indexes saved in dir, creating the directory if needed.
+// Every successful request that changes an index saves it to dir before the response is sent.
+func Open(dir string) (*Server, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := New()
+	s.dir = dir
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), indexFileExt) {
+			continue
+		}
+		name, err := url.PathUnescape(strings.TrimSuffix(f.Name(), indexFileExt))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid index file name %q: %v", f.Name(), err)
+		}
+		idx, err := load(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		s.indexes[name] = idx
+	}
+	return s, nil
+}
+
+func load(file string) (*indextank.MemoryIndex, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot indextank.MemoryIndexSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("Invalid index file %s: %v", file, err)
+	}
+	idx, err := indextank.RestoreMemoryIndex(&snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid index file %s: %v", file, err)
+	}
+	return idx, nil
+}
+
+// Index returns an index, or nil if it does not exist. Changes made to it directly are saved
+// with the next request changing the index, or by Save.
+func (s *Server) Index(name string) *indextank.MemoryIndex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.indexes[name]
+}
+
+// CreateIndex creates an index, or returns the existing one.
+func (s *Server) CreateIndex(name string) (*indextank.MemoryIndex, error) {
+	s.mu.Lock()
+	idx, ok := s.indexes[name]
+	if !ok {
+		idx = indextank.NewMemoryIndex()
+		s.indexes[name] = idx
+	}
+	s.mu.Unlock()
+	if ok {
+		return idx, nil
+	}
+	return idx, s.save(name)
+}
+
+// Save saves all indexes, if the server has a directory.
+func (s *Server) Save() error {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.indexes))
+	for name := range s.indexes {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+	for _, name := range names {
+		if err := s.save(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save writes an index to its file, or removes the file if the index no longer exists.
+func (s *Server) save(name string) error {
+	if s.dir == "" {
+		return nil
+	}
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	file := filepath.Join(s.dir, url.PathEscape(name)+indexFileExt)
+	idx := s.Index(name)
+	if idx == nil {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	snapshot, err := idx.Snapshot()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first, so that a crash never leaves a partial index file
+	tmp, err := ioutil.TempFile(s.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, indexesPath)
+	if rest == r.URL.Path {
+		http.NotFound(w, r)
+		return
+	}
+	name, sub := rest, ""
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		name, sub = rest[:i], rest[i:]
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.dir == "" || r.Method == "GET" || name == "" {
+		s.handle(w, r, name, sub, body)
+		return
+	}
+
+	// buffer the response of a change, to save the index before sending it
+	rec := &response{header: http.Header{}, status: http.StatusOK}
+	s.handle(rec, r, name, sub, body)
+	if rec.status/100 == 2 {
+		if err := s.save(name); err != nil {
+			http.Error(w, "Saving index failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	for k, v := range rec.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.status)
+	w.Write(rec.body.Bytes())
+}
+
+// response is an http.ResponseWriter that keeps the response in memory.
+type response struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *response) Header() http.Header {
+	return r.header
+}
+
+func (r *response) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+}
+
+func (r *response) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.body.Write(b)
+}
+
+// isBatch returns whether a JSON request body holds a list.
+func isBatch(body []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(body), []byte("["))
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/searchify/gotank/indextank"
+)
+
+// serve starts an HTTP server for s and returns a client for it.
+func serve(t *testing.T, s *Server) (indextank.ApiClient, func()) {
+	t.Helper()
+	srv := httptest.NewServer(s)
+	client, err := indextank.NewApiClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, srv.Close
+}
+
+func TestRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, stop := serve(t, s)
+	idx, err := client.CreateIndexWithOptions("products", map[string]interface{}{"public_search": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.AddFunction(1, "relevance * d[0]"); err != nil {
+		t.Fatal(err)
+	}
+	docs := []indextank.Document{
+		{Id: "a", Fields: map[string]string{"text": "red shirt"}, Variables: map[string]float32{"0": 2}, Categories: map[string]string{"color": "red"}},
+		{Id: "b", Fields: map[string]string{"text": "blue shirt"}, Variables: map[string]float32{"0": 5}},
+		{Id: "c", Fields: map[string]string{"text": "gone"}},
+	}
+	if _, err := idx.AddDocuments(docs); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.DeleteDocument("c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateIndex("deleted"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteIndex("deleted"); err != nil {
+		t.Fatal(err)
+	}
+	before, err := s.Index("products").Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop()
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != "products"+indexFileExt {
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name())
+		}
+		t.Errorf("data directory holds %v, want only products%s", names, indexFileExt)
+	}
+
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, stop = serve(t, s)
+	defer stop()
+	indexes, err := client.ListIndexes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexes) != 1 || indexes["products"] == nil {
+		t.Fatalf("indexes after restart: %v", indexes)
+	}
+	after, err := s.Index("products").Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// compare what is saved, without the monotonic clock reading of the creation time
+	if a, b := mustMarshal(t, after), mustMarshal(t, before); a != b {
+		t.Errorf("index after restart:\n%s\nwant\n%s", a, b)
+	}
+
+	query := indextank.QueryForString("shirt")
+	query.ScoringFunction(1)
+	query.FetchCategories()
+	results, err := client.GetIndex("products").SearchWithQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits := results.GetHits()
+	if len(hits) != 2 || hits[0].Docid != "b" || hits[1].Categories["color"] != "red" {
+		t.Errorf("hits after restart: %+v", hits)
+	}
+	metadata, err := client.GetIndex("products").GetMetadata()
+	if err != nil || metadata["public_search"] != true {
+		t.Errorf("metadata after restart: %v, %v", metadata, err)
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestOpenInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "broken"+indexFileExt), []byte(`{"documents": [`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(dir); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Open = %v, want an error naming the broken file", err)
+	}
+}
+
+func TestSaveFailure(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, stop := serve(t, s)
+	defer stop()
+	idx, err := client.CreateIndex("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a change that can't be saved fails
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	err = idx.AddDocument("a", map[string]string{"text": "hello"}, nil, nil)
+	var apiErr *indextank.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 500 || !strings.Contains(apiErr.Body, "Saving index failed") {
+		t.Errorf("AddDocument = %v, want a save error", err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	client, stop := serve(t, New())
+	defer stop()
+
+	if _, err := client.GetIndex("missing").Search("x"); !errors.Is(err, indextank.ErrIndexNotFound) {
+		t.Errorf("Search of a missing index = %v, want ErrIndexNotFound", err)
+	}
+	idx, err := client.CreateIndex("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateIndex("test"); !errors.Is(err, indextank.ErrIndexAlreadyExists) {
+		t.Errorf("CreateIndex of an existing index = %v, want ErrIndexAlreadyExists", err)
+	}
+	if _, err := idx.Search("a OR"); !errors.Is(err, indextank.ErrInvalidQuery) {
+		t.Errorf("Search of an invalid query = %v, want ErrInvalidQuery", err)
+	}
+	if err := idx.AddFunction(1, "log("); err == nil {
+		t.Error("AddFunction accepted an invalid definition")
+	}
+	if err := idx.AddDocument("a", map[string]string{"text": "hello"}, map[int]float32{0: 1}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.UpdateVariables("a", map[int]float32{0: 7}); err != nil {
+		t.Fatal(err)
+	}
+	query := indextank.QueryForString("hello")
+	query.FetchVariables()
+	results, err := idx.SearchWithQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits := results.GetHits(); len(hits) != 1 || hits[0].Variables[0] != 7 {
+		t.Errorf("hits = %+v, want a with variable 0 = 7", hits)
+	}
+	if deleted, err := idx.DeleteBySearch(indextank.QueryForString("hello")); err != nil || deleted != 1 {
+		t.Errorf("DeleteBySearch = %d, %v, want 1", deleted, err)
+	}
+}
@@ -0,0 +1,186 @@
+package indextank
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// tagKind is the part of a document a tagged struct field maps to.
+type tagKind int
+
+const (
+	tagDocid tagKind = iota + 1
+	tagField
+	tagVar
+	tagCategory
+	tagTimestamp
+	tagSnippet
+	tagScore
+)
+
+// timestampField is the document field holding a document's timestamp, in seconds since the epoch.
+const timestampField = "timestamp"
+
+// fieldMapping maps a struct field to a part of a document, e.g. `indextank:"field=title"`.
+type fieldMapping struct {
+	kind tagKind
+	// document field or category name
+	name string
+	// variable number
+	num       int
+	omitEmpty bool
+	// index of the struct field, for reflect.Value.FieldByIndex
+	index  []int
+	goName string
+}
+
+// structMapping holds the tagged fields of a struct type.
+type structMapping struct {
+	fields []fieldMapping
+}
+
+var structMappings sync.Map // reflect.Type -> *structMapping
+
+// mappingOf returns the mapping of a struct type, which is parsed once and cached.
+func mappingOf(t reflect.Type) (*structMapping, error) {
+	if m, ok := structMappings.Load(t); ok {
+		return m.(*structMapping), nil
+	}
+	m := &structMapping{}
+	if err := m.add(t, nil, map[string]string{}); err != nil {
+		return nil, err
+	}
+	structMappings.Store(t, m)
+	return m, nil
+}
+
+// add adds the tagged fields of t, and of its untagged embedded structs, to the mapping.
+// seen records the targets already mapped, to report duplicates.
+func (m *structMapping) add(t reflect.Type, index []int, seen map[string]string) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("indextank")
+		if !ok {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if f.Anonymous && ft.Kind() == reflect.Struct {
+				if err := m.add(ft, append(append([]int{}, index...), i), seen); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if tag == "-" {
+			continue
+		}
+		goName := t.Name() + "." + f.Name
+		if f.PkgPath != "" {
+			return fmt.Errorf("Unexported field %s has an indextank tag", goName)
+		}
+		fm, err := parseTag(tag)
+		if err != nil {
+			return fmt.Errorf("Invalid indextank tag on %s: %v", goName, err)
+		}
+		fm.index = append(append([]int{}, index...), i)
+		fm.goName = goName
+		target := fm.target()
+		if other, ok := seen[target]; ok {
+			return fmt.Errorf("%s and %s both map to %s", other, goName, target)
+		}
+		seen[target] = goName
+		m.fields = append(m.fields, fm)
+	}
+	return nil
+}
+
+// parseTag parses an indextank struct tag: docid, timestamp, score, field=name, var=n, category=name
+// or snippet=name, optionally followed by ",omitempty".
+func parseTag(tag string) (fieldMapping, error) {
+	var fm fieldMapping
+	parts := strings.Split(tag, ",")
+	for _, option := range parts[1:] {
+		if option != "omitempty" {
+			return fm, fmt.Errorf("unknown option %q", option)
+		}
+		fm.omitEmpty = true
+	}
+	key, value := parts[0], ""
+	if i := strings.IndexByte(key, '='); i >= 0 {
+		key, value = key[:i], key[i+1:]
+	}
+	switch key {
+	case "docid", "timestamp", "score":
+		if value != "" {
+			return fm, fmt.Errorf("%s takes no value", key)
+		}
+		switch key {
+		case "docid":
+			fm.kind = tagDocid
+		case "timestamp":
+			fm.kind = tagTimestamp
+		case "score":
+			fm.kind = tagScore
+		}
+		return fm, nil
+	case "field":
+		fm.kind = tagField
+	case "category":
+		fm.kind = tagCategory
+	case "snippet":
+		fm.kind = tagSnippet
+	case "var":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fm, fmt.Errorf("variable number %q is not a non-negative integer", value)
+		}
+		fm.kind, fm.num = tagVar, n
+		return fm, nil
+	default:
+		return fm, fmt.Errorf("unknown mapping %q", key)
+	}
+	if value == "" {
+		return fm, fmt.Errorf("%s needs a name, e.g. %s=name", key, key)
+	}
+	fm.name = value
+	return fm, nil
+}
+
+// target describes what a mapping maps to, e.g. "field title".
+func (fm fieldMapping) target() string {
+	switch fm.kind {
+	case tagDocid:
+		return "docid"
+	case tagField:
+		return "field " + fm.name
+	case tagVar:
+		return "variable " + strconv.Itoa(fm.num)
+	case tagCategory:
+		return "category " + fm.name
+	case tagTimestamp:
+		return "field " + timestampField
+	case tagSnippet:
+		return "snippet " + fm.name
+	case tagScore:
+		return "score"
+	}
+	return ""
+}
+
+// fieldByIndex returns the struct field of v at index, and false if it is inside a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
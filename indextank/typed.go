@@ -0,0 +1,118 @@
+package indextank
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Codec converts values of type T to documents, and search hits back to values, for a TypedIndex.
+type Codec[T any] interface {
+	Encode(v T) (Document, error)
+	Decode(hit Hit) (T, error)
+}
+
+// TagCodec is a Codec for structs, or pointers to structs, with indextank tags. It converts them
+// with MarshalDocument and Hit.Decode.
+type TagCodec[T any] struct{}
+
+func (TagCodec[T]) Encode(v T) (Document, error) {
+	return MarshalDocument(v)
+}
+
+func (TagCodec[T]) Decode(hit Hit) (T, error) {
+	var v T
+	e := alloc(reflect.ValueOf(&v).Elem())
+	if e.Kind() != reflect.Struct {
+		return v, fmt.Errorf("Can't decode a hit into %T, it is not a struct", v)
+	}
+	return v, hit.decode(e)
+}
+
+// TypedHit is a search hit along with its value decoded by the Codec of a TypedIndex.
+type TypedHit[T any] struct {
+	Hit
+	Value T
+}
+
+// TypedIndex wraps an Index to add, delete and search for values of type T, converted to and from
+// documents by a Codec:
+//
+//	products := indextank.NewTypedIndex[Product](idx, nil)
+//	err := products.Add(ctx, Product{SKU: "123", Name: "Gopher plush"})
+//	query := indextank.QueryForString("gopher")
+//	query.FetchFields("*")
+//	hits, err := products.Search(ctx, query)
+//	fmt.Println(hits[0].Value.Name)
+type TypedIndex[T any] interface {
+	// Index returns the wrapped index.
+	Index() Index
+	// Add adds or replaces the document for v.
+	Add(ctx context.Context, v T) error
+	// AddAll adds or replaces the documents for vs in one batch. The position of each value in
+	// vs is its position in the results. No document is sent if any value can't be encoded.
+	AddAll(ctx context.Context, vs []T) (BatchResults, error)
+	// Delete deletes the document with the given id.
+	Delete(ctx context.Context, docid string) error
+	// Search returns the hits of a query with their decoded values. The query must fetch the
+	// fields, variables and categories the codec needs, e.g. with FetchFields("*").
+	Search(ctx context.Context, query Query) ([]TypedHit[T], error)
+}
+
+type typedIndex[T any] struct {
+	index Index
+	codec Codec[T]
+}
+
+// NewTypedIndex returns a TypedIndex for index. If codec is nil, a TagCodec is used.
+func NewTypedIndex[T any](index Index, codec Codec[T]) TypedIndex[T] {
+	if codec == nil {
+		codec = TagCodec[T]{}
+	}
+	return &typedIndex[T]{index, codec}
+}
+
+func (ti *typedIndex[T]) Index() Index {
+	return ti.index
+}
+
+func (ti *typedIndex[T]) Add(ctx context.Context, v T) error {
+	doc, err := ti.codec.Encode(v)
+	if err != nil {
+		return err
+	}
+	return ti.index.AddDocumentContext(ctx, doc.Id, doc.Fields, doc.NumberedVariables(), doc.Categories)
+}
+
+func (ti *typedIndex[T]) AddAll(ctx context.Context, vs []T) (BatchResults, error) {
+	docs := make([]Document, len(vs))
+	for i, v := range vs {
+		doc, err := ti.codec.Encode(v)
+		if err != nil {
+			return nil, fmt.Errorf("Element %d: %v", i, err)
+		}
+		docs[i] = doc
+	}
+	return ti.index.AddDocumentsContext(ctx, docs)
+}
+
+func (ti *typedIndex[T]) Delete(ctx context.Context, docid string) error {
+	return ti.index.DeleteDocumentContext(ctx, docid)
+}
+
+func (ti *typedIndex[T]) Search(ctx context.Context, query Query) ([]TypedHit[T], error) {
+	results, err := ti.index.SearchWithQueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	hits := results.GetHits()
+	typed := make([]TypedHit[T], len(hits))
+	for i, hit := range hits {
+		v, err := ti.codec.Decode(hit)
+		if err != nil {
+			return nil, err
+		}
+		typed[i] = TypedHit[T]{hit, v}
+	}
+	return typed, nil
+}
@@ -0,0 +1,140 @@
+package indextank
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type product struct {
+	SKU   string  `indextank:"docid"`
+	Name  string  `indextank:"field=text"`
+	Color string  `indextank:"category=color"`
+	Price float64 `indextank:"var=0"`
+	Score float64 `indextank:"score"`
+}
+
+// fetchAll returns a query fetching everything TagCodec needs to decode products.
+func fetchAll(s string) Query {
+	q := QueryForString(s)
+	q.FetchFields("*")
+	q.FetchVariables()
+	q.FetchCategories()
+	q.ScoringFunction(1)
+	return q
+}
+
+func newProductIndex(t *testing.T) *MemoryIndex {
+	t.Helper()
+	idx := NewMemoryIndex()
+	if err := idx.AddFunction(1, "doc.var[0]"); err != nil {
+		t.Fatal(err)
+	}
+	return idx
+}
+
+func TestTypedIndex(t *testing.T) {
+	idx := newProductIndex(t)
+	products := NewTypedIndex[product](idx, nil)
+	ctx := context.Background()
+	if err := products.Add(ctx, product{SKU: "1", Name: "gopher plush", Color: "blue", Price: 20}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := products.AddAll(ctx, []product{
+		{SKU: "2", Name: "gopher mug", Color: "white", Price: 10},
+		{SKU: "3", Name: "gopher sticker", Color: "blue", Price: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := products.Delete(ctx, "3"); err != nil {
+		t.Fatal(err)
+	}
+
+	hits, err := products.Search(ctx, fetchAll("gopher"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []product{
+		{SKU: "1", Name: "gopher plush", Color: "blue", Price: 20, Score: 20},
+		{SKU: "2", Name: "gopher mug", Color: "white", Price: 10, Score: 10},
+	}
+	if len(hits) != len(want) {
+		t.Fatalf("%d hits, want %d", len(hits), len(want))
+	}
+	for i, hit := range hits {
+		if hit.Value != want[i] || hit.Docid != want[i].SKU {
+			t.Errorf("hit %d = %s %+v, want %+v", i, hit.Docid, hit.Value, want[i])
+		}
+	}
+	if products.Index() != Index(idx) {
+		t.Error("Index() doesn't return the wrapped index")
+	}
+}
+
+func TestTypedIndexPointers(t *testing.T) {
+	idx := newProductIndex(t)
+	products := NewTypedIndex[*product](idx, TagCodec[*product]{})
+	ctx := context.Background()
+	if err := products.Add(ctx, &product{SKU: "1", Name: "gopher plush", Price: 20}); err != nil {
+		t.Fatal(err)
+	}
+	hits, err := products.Search(ctx, fetchAll("gopher"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &product{SKU: "1", Name: "gopher plush", Price: 20, Score: 20}
+	if len(hits) != 1 || !reflect.DeepEqual(hits[0].Value, want) {
+		t.Errorf("hits = %+v, want %+v", hits, want)
+	}
+
+	if _, err := (TagCodec[int]{}).Decode(Hit{Docid: "1"}); err == nil {
+		t.Error("TagCodec[int] decoded a hit")
+	}
+}
+
+// failingCodec is a TagCodec that fails to encode products named "bad".
+type failingCodec struct {
+	TagCodec[product]
+}
+
+func (failingCodec) Encode(p product) (Document, error) {
+	if p.Name == "bad" {
+		return Document{}, errors.New("bad product")
+	}
+	return MarshalDocument(p)
+}
+
+func TestTypedIndexAddAllEncodeError(t *testing.T) {
+	idx := newProductIndex(t)
+	products := NewTypedIndex[product](idx, failingCodec{})
+	_, err := products.AddAll(context.Background(), []product{
+		{SKU: "1", Name: "good"},
+		{SKU: "2", Name: "bad"},
+		{SKU: "3", Name: "good"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "Element 1") {
+		t.Errorf("AddAll = %v, want an error for element 1", err)
+	}
+	if n := idx.GetSize(); n != 0 {
+		t.Errorf("AddAll sent %d documents before failing", n)
+	}
+}
+
+func TestTypedIndexDecodeError(t *testing.T) {
+	idx := newProductIndex(t)
+	if err := idx.AddDocument("1", map[string]string{"text": "gopher"}, map[int]float32{0: 1.5}, nil); err != nil {
+		t.Fatal(err)
+	}
+	type strict struct {
+		ID    string `indextank:"docid"`
+		Count int    `indextank:"var=0"`
+	}
+	_, err := NewTypedIndex[strict](idx, nil).Search(context.Background(), fetchAll("gopher"))
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Errorf("Search = %v, want a DecodeError", err)
+	}
+}
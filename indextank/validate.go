@@ -0,0 +1,106 @@
+package indextank
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// ErrInvalidDocument is wrapped by the errors of documents that fail validation, see DocumentLimits.
+var ErrInvalidDocument = errors.New("Invalid document")
+
+// DocumentLimits are the limits documents are validated against before they are sent. A zero limit
+// is not checked.
+type DocumentLimits struct {
+	// Maximum length of a docid, in bytes
+	MaxDocidBytes int
+	// Maximum total length of the field names and texts of a document, in bytes
+	MaxDocumentBytes int
+	// Highest variable index allowed
+	MaxVariable int
+	// Maximum length of a category name or value, in bytes
+	MaxCategoryBytes int
+}
+
+// DefaultDocumentLimits are the limits of IndexTank, used by NewDocument and by clients created without
+// WithDocumentLimits. Indexes can be configured with more variables, in which case MaxVariable
+// should be raised.
+var DefaultDocumentLimits = DocumentLimits{
+	MaxDocidBytes:    1024,
+	MaxDocumentBytes: 100 * 1024,
+	MaxVariable:      15,
+	MaxCategoryBytes: 1024,
+}
+
+// Validate checks a document against the limits. It also checks that the docid is not empty, that
+// the document has fields, that names and texts are valid UTF-8, that category names are not empty and that variables are finite.
+// The error wraps ErrInvalidDocument.
+func (l DocumentLimits) Validate(doc Document) error {
+	if err := l.validate(doc); err != nil {
+		return fmt.Errorf("%w %q: %v", ErrInvalidDocument, doc.Id, err)
+	}
+	return nil
+}
+
+func (l DocumentLimits) validate(doc Document) error {
+	switch {
+	case doc.Id == "":
+		return errors.New("empty docid")
+	case !utf8.ValidString(doc.Id):
+		return errors.New("docid is not valid UTF-8")
+	case l.MaxDocidBytes > 0 && len(doc.Id) > l.MaxDocidBytes:
+		return fmt.Errorf("docid is longer than %d bytes", l.MaxDocidBytes)
+	}
+
+	if len(doc.Fields) == 0 {
+		return errors.New("no fields")
+	}
+	size := 0
+	for name, text := range doc.Fields {
+		switch {
+		case name == "":
+			return errors.New("empty field name")
+		case !utf8.ValidString(name):
+			return fmt.Errorf("field name %q is not valid UTF-8", name)
+		case !utf8.ValidString(text):
+			return fmt.Errorf("field %s is not valid UTF-8", name)
+		}
+		size += len(name) + len(text)
+	}
+	if l.MaxDocumentBytes > 0 && size > l.MaxDocumentBytes {
+		return fmt.Errorf("fields are %d bytes, more than %d", size, l.MaxDocumentBytes)
+	}
+
+	for k, v := range doc.Variables {
+		n, err := strconv.Atoi(k)
+		switch {
+		case err != nil || n < 0:
+			return fmt.Errorf("invalid variable index %q", k)
+		case l.MaxVariable > 0 && n > l.MaxVariable:
+			return fmt.Errorf("variable index %d is higher than %d", n, l.MaxVariable)
+		case math.IsNaN(float64(v)) || math.IsInf(float64(v), 0):
+			return fmt.Errorf("variable %d is %v", n, v)
+		}
+	}
+
+	for name, value := range doc.Categories {
+		switch {
+		case name == "":
+			return errors.New("empty category name")
+		case !utf8.ValidString(name):
+			return fmt.Errorf("category name %q is not valid UTF-8", name)
+		case !utf8.ValidString(value):
+			return fmt.Errorf("category %s is not valid UTF-8", name)
+		case l.MaxCategoryBytes > 0 && (len(name) > l.MaxCategoryBytes || len(value) > l.MaxCategoryBytes):
+			return fmt.Errorf("category %s is longer than %d bytes", name, l.MaxCategoryBytes)
+		}
+	}
+	return nil
+}
+
+// ValidateDocument checks a document against DefaultDocumentLimits.
+func ValidateDocument(doc Document) error {
+	return DefaultDocumentLimits.Validate(doc)
+}
@@ -0,0 +1,80 @@
+package indextank
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestDocumentLimits(t *testing.T) {
+	limits := DocumentLimits{MaxDocidBytes: 4, MaxDocumentBytes: 10, MaxVariable: 2, MaxCategoryBytes: 3}
+	text := map[string]string{"text": "hi"}
+	tests := []struct {
+		name string
+		doc  Document
+		// the error message, or "" if the document is valid
+		want string
+	}{
+		{"valid", Document{Id: "abcd", Fields: map[string]string{"text": "123456"}, Variables: map[string]float32{"2": 1}, Categories: map[string]string{"abc": "xyz"}}, ""},
+
+		{"empty docid", Document{Fields: text}, "empty docid"},
+		{"invalid docid", Document{Id: "\xff", Fields: text}, "docid is not valid UTF-8"},
+		{"long docid", Document{Id: "abcde", Fields: text}, "docid is longer than 4 bytes"},
+		// "é" is one rune but two bytes
+		{"multi-byte docid", Document{Id: "ééé", Fields: text}, "docid is longer than 4 bytes"},
+		{"multi-byte docid at the limit", Document{Id: "éé", Fields: text}, ""},
+
+		{"nil fields", Document{Id: "1"}, "no fields"},
+		{"empty fields", Document{Id: "1", Fields: map[string]string{}}, "no fields"},
+		{"empty field name", Document{Id: "1", Fields: map[string]string{"": "hi"}}, "empty field name"},
+		{"invalid field name", Document{Id: "1", Fields: map[string]string{"\xff": "hi"}}, `field name "\xff" is not valid UTF-8`},
+		{"invalid field", Document{Id: "1", Fields: map[string]string{"text": "\xff"}}, "field text is not valid UTF-8"},
+		{"long fields", Document{Id: "1", Fields: map[string]string{"text": "1234", "a": "12"}}, "fields are 11 bytes, more than 10"},
+		{"multi-byte fields at the limit", Document{Id: "1", Fields: map[string]string{"text": "ééé"}}, ""},
+		{"multi-byte fields over the limit", Document{Id: "1", Fields: map[string]string{"text": "éééa"}}, "fields are 11 bytes, more than 10"},
+
+		{"invalid variable", Document{Id: "1", Fields: text, Variables: map[string]float32{"x": 1}}, `invalid variable index "x"`},
+		{"negative variable", Document{Id: "1", Fields: text, Variables: map[string]float32{"-1": 1}}, `invalid variable index "-1"`},
+		{"high variable", Document{Id: "1", Fields: text, Variables: map[string]float32{"3": 1}}, "variable index 3 is higher than 2"},
+		{"NaN variable", Document{Id: "1", Fields: text, Variables: map[string]float32{"0": float32(math.NaN())}}, "variable 0 is NaN"},
+		{"infinite variable", Document{Id: "1", Fields: text, Variables: map[string]float32{"1": float32(math.Inf(1))}}, "variable 1 is +Inf"},
+
+		{"empty category name", Document{Id: "1", Fields: text, Categories: map[string]string{"": "x"}}, "empty category name"},
+		{"invalid category name", Document{Id: "1", Fields: text, Categories: map[string]string{"\xff": "x"}}, `category name "\xff" is not valid UTF-8`},
+		{"invalid category", Document{Id: "1", Fields: text, Categories: map[string]string{"c": "\xff"}}, "category c is not valid UTF-8"},
+		{"long category name", Document{Id: "1", Fields: text, Categories: map[string]string{"abcd": "x"}}, "category abcd is longer than 3 bytes"},
+		{"long category value", Document{Id: "1", Fields: text, Categories: map[string]string{"c": "wxyz"}}, "category c is longer than 3 bytes"},
+		{"multi-byte category", Document{Id: "1", Fields: text, Categories: map[string]string{"c": "éé"}}, "category c is longer than 3 bytes"},
+	}
+	for _, test := range tests {
+		err := limits.Validate(test.doc)
+		switch {
+		case test.want == "" && err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case test.want == "":
+		case !errors.Is(err, ErrInvalidDocument):
+			t.Errorf("%s: Validate = %v, want ErrInvalidDocument", test.name, err)
+		case !strings.HasSuffix(err.Error(), ": "+test.want):
+			t.Errorf("%s: Validate = %q, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestDocumentLimitsZero(t *testing.T) {
+	doc := Document{
+		Id:         strings.Repeat("d", 2000),
+		Fields:     map[string]string{"text": strings.Repeat("x", 200*1024)},
+		Variables:  map[string]float32{"100": 1},
+		Categories: map[string]string{"c": strings.Repeat("x", 2000)},
+	}
+	if err := (DocumentLimits{}).Validate(doc); err != nil {
+		t.Errorf("zero limits: %v", err)
+	}
+	if err := ValidateDocument(doc); err == nil {
+		t.Error("ValidateDocument accepted a document over the default limits")
+	}
+	if err := ValidateDocument(Document{Id: "1"}); !errors.Is(err, ErrInvalidDocument) {
+		t.Errorf("ValidateDocument of a document without fields = %v, want ErrInvalidDocument", err)
+	}
+}